@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// diffHunk is a hunk of "git diff -U0", i.e. without context lines.
+type diffHunk struct {
+	File     string
+	OldStart int
+	OldCount int
+	NewStart int
+	NewCount int
+	Lines    []string // the "-" and "+" lines
+
+	Target *Commit // the stack commit to absorb the hunk into
+}
+
+var regexpHunkHeader = regexp.MustCompile(`^@@ -([0-9]+)(?:,([0-9]+))? \+([0-9]+)(?:,([0-9]+))? @@`)
+
+// absorbChanges distributes the uncommitted changes to the commits of the stack which last touched the same lines,
+// then submits the stack again. Changes which can not be matched to a single commit are left in the working tree.
+func absorbChanges(args []string) {
+	if len(args) > 0 {
+		exitCodef(ExitConfig, "usage: git pr absorb")
+	}
+	originMain := fmt.Sprintf("%v/%v", config.Remote, config.MainBranch)
+	stackedCommits := must(getStackedCommits(originMain, head))
+	if len(stackedCommits) == 0 {
+		exitf("no commits to absorb into")
+	}
+
+	// the fixup commits are created from the index: it must not have other changes
+	if _, err := execGit("diff", "--cached", "--quiet"); err != nil {
+		exitCodef(ExitDirtyWorktree, "the index has staged changes\n\nHint: unstage them with \"git reset\", or commit them first")
+	}
+
+	diff := must(execGit("diff", "-U0", "--no-color", "--no-ext-diff", head))
+	// the file names from the "diff --git" lines are quoted or ambiguous with special characters: list them apart, in
+	// the same order
+	out := must(execGit("diff", "-z", "--name-only", "--no-ext-diff", head))
+	files := strings.FieldsFunc(out, func(r rune) bool { return r == 0 })
+	hunks, skippedFiles := parseDiffHunks(diff, files)
+	if len(hunks) == 0 && len(skippedFiles) == 0 {
+		exitCodef(ExitConfig, "no changes to absorb")
+	}
+
+	// match each hunk to the stack commit which last touched the surrounding lines
+	stackIndex := map[string]int{}
+	for i, commit := range stackedCommits {
+		stackIndex[commit.Hash] = i
+	}
+	targets := map[*Commit][]*diffHunk{}
+	var leftovers []*diffHunk
+	for _, hunk := range hunks {
+		hunk.Target = findAbsorbTarget(hunk, stackedCommits, stackIndex)
+		if hunk.Target == nil {
+			leftovers = append(leftovers, hunk)
+			continue
+		}
+		targets[hunk.Target] = append(targets[hunk.Target], hunk)
+	}
+	if len(targets) == 0 {
+		exitf("no changes can be absorbed into the stack\n\nHint: use \"git pr amend <commit>\" to choose the commit")
+	}
+
+	// create one fixup commit for each target, from the bottom of the stack
+	var applied []*diffHunk
+	oldest := len(stackedCommits)
+	for i, commit := range stackedCommits {
+		group := targets[commit]
+		if len(group) == 0 {
+			continue
+		}
+		oldest = xif(i < oldest, i, oldest)
+		fmt.Printf("absorb %v hunk(s) into %v\n", len(group), commit)
+		patchFile := must(os.CreateTemp("", "git-pr-absorb-*.patch"))
+		fprint(patchFile, buildAbsorbPatch(group, applied))
+		must(0, patchFile.Close())
+		_, err := execGit("apply", "--cached", "--unidiff-zero", patchFile.Name())
+		_ = os.Remove(patchFile.Name())
+		if err != nil {
+			_, _ = execGit("reset", "-q") // back to the fixups committed so far, the working tree is untouched
+			must(0, err)
+		}
+		must(execGit("commit", "--no-verify", "--fixup", commit.Hash))
+		applied = append(applied, group...)
+	}
+	_, err := execGit("-c", "sequence.editor=true", "rebase", "--interactive", "--autosquash", "--autostash", stackedCommits[oldest].Hash+"^")
+	if err != nil {
+		exitCodef(ExitConflict, `failed to squash the absorbed changes
+
+Hint: resolve the conflicts and run "git rebase --continue", then "git pr"`)
+	}
+
+	if len(leftovers) > 0 || len(skippedFiles) > 0 {
+		fmt.Println("\nthese changes could not be absorbed and are left in the working tree:")
+		for _, file := range skippedFiles {
+			fmt.Printf("  %v\n", file)
+		}
+		for _, hunk := range leftovers {
+			fmt.Printf("  %v:%v\n", hunk.File, hunk.NewStart)
+		}
+		fmt.Print(`
+Hint: use "git pr amend <commit>" to choose the commit for them, then "git pr" to submit
+`)
+		return
+	}
+	submitStack()
+}
+
+// findAbsorbTarget returns the stack commit which last touched all the lines changed by the hunk (or the lines around
+// an insertion), or nil if there is no such single commit.
+func findAbsorbTarget(hunk *diffHunk, commits []*Commit, stackIndex map[string]int) *Commit {
+	var hashes []string
+	if hunk.OldCount > 0 {
+		hashes = blameLines(hunk.File, hunk.OldStart, hunk.OldStart+hunk.OldCount-1)
+	} else {
+		// an insertion after line OldStart: look at the lines before and after it
+		for _, line := range []int{hunk.OldStart, hunk.OldStart + 1} {
+			if line >= 1 {
+				hashes = append(hashes, blameLines(hunk.File, line, line)...)
+			}
+		}
+	}
+	var target *Commit
+	for _, hash := range hashes {
+		idx, ok := stackIndex[hash]
+		if !ok {
+			return nil // the line comes from the main branch
+		}
+		if target != nil && target != commits[idx] {
+			return nil // ambiguous
+		}
+		target = commits[idx]
+	}
+	return target
+}
+
+// blameLines returns the commit hashes which last touched the lines (inclusive) at HEAD.
+func blameLines(file string, start, end int) (hashes []string) {
+	out, err := execGit("blame", "-l", "-s", "-L", fmt.Sprintf("%v,%v", start, end), head, "--", file)
+	if err != nil {
+		return nil // out of range
+	}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 {
+			hashes = append(hashes, strings.TrimPrefix(fields[0], "^"))
+		}
+	}
+	return hashes
+}
+
+// parseDiffHunks parses the output of "git diff -U0", whose files are listed in the same order by "git diff -z
+// --name-only". New, deleted, renamed, and binary files can not be absorbed and are returned as skipped.
+func parseDiffHunks(diff string, files []string) (hunks []*diffHunk, skippedFiles []string) {
+	var file string
+	var hunk *diffHunk
+	skip := false
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			file, hunk, skip = "", nil, false
+			if len(files) > 0 {
+				file, files = files[0], files[1:]
+			}
+		case strings.HasPrefix(line, "new file"), strings.HasPrefix(line, "deleted file"),
+			strings.HasPrefix(line, "rename from"), strings.HasPrefix(line, "Binary files"):
+			if !skip {
+				skippedFiles = append(skippedFiles, file)
+			}
+			skip = true
+		case skip, strings.HasPrefix(line, "--- "), strings.HasPrefix(line, "+++ "):
+			// ignore
+		case strings.HasPrefix(line, "@@ "):
+			m := regexpHunkHeader.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			hunk = &diffHunk{
+				File:     file,
+				OldStart: must(strconv.Atoi(m[1])),
+				OldCount: parseHunkCount(m[2]),
+				NewStart: must(strconv.Atoi(m[3])),
+				NewCount: parseHunkCount(m[4]),
+			}
+			hunks = append(hunks, hunk)
+		case hunk != nil && (strings.HasPrefix(line, "-") || strings.HasPrefix(line, "+") || strings.HasPrefix(line, `\`)):
+			hunk.Lines = append(hunk.Lines, line)
+		}
+	}
+	return hunks, skippedFiles
+}
+
+// patchPath quotes the path for a patch header like git does, when it has quotes, backslashes, or control characters.
+func patchPath(path string) string {
+	if strings.ContainsAny(path, "\"\\\t\n") {
+		return strconv.Quote(path)
+	}
+	return path
+}
+
+func parseHunkCount(s string) int {
+	if s == "" {
+		return 1
+	}
+	return must(strconv.Atoi(s))
+}
+
+// buildAbsorbPatch builds a patch of the hunks against the index, where the already applied hunks shifted the lines.
+func buildAbsorbPatch(hunks, applied []*diffHunk) string {
+	byFile := map[string][]*diffHunk{}
+	var files []string
+	for _, hunk := range hunks {
+		if byFile[hunk.File] == nil {
+			files = append(files, hunk.File)
+		}
+		byFile[hunk.File] = append(byFile[hunk.File], hunk)
+	}
+	sort.Strings(files)
+
+	var b strings.Builder
+	for _, file := range files {
+		a, b2 := patchPath("a/"+file), patchPath("b/"+file)
+		fprintf(&b, "diff --git %v %v\n--- %v\n+++ %v\n", a, b2, a, b2)
+		delta := 0 // the lines added by the previous hunks in this patch
+		for _, hunk := range byFile[file] {
+			oldStart := hunk.OldStart
+			for _, h := range applied {
+				if h.File == file && h.OldStart < hunk.OldStart {
+					oldStart += h.NewCount - h.OldCount
+				}
+			}
+			newStart := oldStart + delta
+			switch {
+			case hunk.OldCount == 0:
+				newStart++
+			case hunk.NewCount == 0:
+				newStart--
+			}
+			fprintf(&b, "@@ -%v,%v +%v,%v @@\n", oldStart, hunk.OldCount, newStart, hunk.NewCount)
+			for _, line := range hunk.Lines {
+				fprint(&b, line, "\n")
+			}
+			delta += hunk.NewCount - hunk.OldCount
+		}
+	}
+	return b.String()
+}
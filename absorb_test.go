@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestParseDiffHunks(t *testing.T) {
+	diff := `diff --git a/f.txt b/f.txt
+index 1111111..2222222 100644
+--- a/f.txt
++++ b/f.txt
+@@ -3 +3 @@ func main() {
+-lined
++CHANGED3
+@@ -8,0 +9,2 @@
++INS1
++INS2
+diff --git a/new.txt b/new.txt
+new file mode 100644
+index 0000000..3333333
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1 @@
++hello
+`
+	hunks, skipped := parseDiffHunks(diff, []string{"f.txt", "new.txt"})
+	if len(skipped) != 1 || skipped[0] != "new.txt" {
+		t.Errorf("skipped = %v, want [new.txt]", skipped)
+	}
+	if len(hunks) != 2 {
+		t.Fatalf("len(hunks) = %v, want 2", len(hunks))
+	}
+	if h := hunks[1]; h.File != "f.txt" || h.OldStart != 8 || h.OldCount != 0 || h.NewStart != 9 || h.NewCount != 2 || len(h.Lines) != 2 {
+		t.Errorf("hunks[1] = %+v", h)
+	}
+}
+
+func TestBuildAbsorbPatch(t *testing.T) {
+	applied := []*diffHunk{{File: "f.txt", OldStart: 8, OldCount: 0, NewCount: 2}}
+	hunks := []*diffHunk{{File: "f.txt", OldStart: 12, OldCount: 2, NewCount: 0, Lines: []string{"-a", "-b"}}}
+	out := buildAbsorbPatch(hunks, applied)
+	expected := "diff --git a/f.txt b/f.txt\n--- a/f.txt\n+++ b/f.txt\n@@ -14,2 +13,0 @@\n-a\n-b\n"
+	if out != expected {
+		t.Errorf("buildAbsorbPatch() = %q, want %q", out, expected)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// adoptBranch converts a long-lived feature branch into a stack: the branch is linearized onto the main branch, the
+// user is guided to split and squash its commits into logical ones with an interactive rebase, then the commits are
+// submitted as a stack. The branch itself is left untouched, the stack is built on a detached HEAD.
+func adoptBranch(args []string) {
+	if len(args) != 1 {
+		exitCodef(ExitConfig, "usage: git pr adopt-branch <branch>")
+	}
+	branch := args[0]
+	ensureGitStatusClean()
+	if _, err := execGit("rev-parse", "--verify", "--quiet", branch+"^{commit}"); err != nil {
+		exitCodef(ExitConfig, "branch %q not found", branch)
+	}
+	originMain := fmt.Sprintf("%v/%v", config.Remote, config.MainBranch)
+	must(execGitRemote(config.Remote, "fetch", config.Remote, config.MainBranch))
+
+	merges := strings.Fields(must(execGit("rev-list", "--merges", originMain+".."+branch)))
+	if len(merges) > 0 {
+		fmt.Printf("%v has %v merge commits, a stack must be linear\n", branch, len(merges))
+		if !promptYesNo(fmt.Sprintf("Rebase the commits of %v onto %v?", branch, originMain)) {
+			exitf("aborted")
+		}
+	}
+	must(execGit("checkout", "--detach", branch))
+	if len(merges) > 0 {
+		if _, err := execGit("rebase", originMain); err != nil {
+			exitCodef(ExitConflict, `failed to rebase %v onto %v
+
+Hint: resolve the conflicts and run "git rebase --continue", then "git pr adopt-branch HEAD"`, branch, originMain)
+		}
+	}
+
+	stackedCommits := must(getStackedCommits(originMain, head))
+	if len(stackedCommits) == 0 {
+		exitf("%v has no commits on top of %v", branch, originMain)
+	}
+	fmt.Printf("\n%v commits on top of %v:\n", len(stackedCommits), originMain)
+	for _, commit := range stackedCommits {
+		fmt.Printf("  %v\n", commit)
+	}
+	fmt.Print(`
+Each commit becomes a PR. In the interactive rebase:
+  - "fixup" or "squash" the WIP commits into the commit they belong to
+  - "edit" a commit to split it: run "git reset HEAD^", then "git add -p" and "git commit" for each part,
+    then "git rebase --continue"
+  - "reword" the commits to give them a title and a description for their PR
+  - reorder the lines to put the foundations at the bottom of the stack
+
+`)
+	if promptYesNo("Edit the commits with an interactive rebase now?") {
+		if err := execInteractive("git", "rebase", "--interactive", originMain); err != nil {
+			exitCodef(ExitConflict, `the rebase stopped
+
+Hint: finish it with "git rebase --continue", then "git pr"`)
+		}
+		stackedCommits = must(getStackedCommits(originMain, head))
+		fmt.Println()
+		for _, commit := range stackedCommits {
+			fmt.Printf("  %v\n", commit)
+		}
+	}
+	if !promptYesNo(fmt.Sprintf("Submit these %v commits as a stack?", len(stackedCommits))) {
+		fmt.Println(`run "git pr" to submit the stack when it's ready`)
+		return
+	}
+	submitStack()
+}
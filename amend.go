@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// amendCommit absorbs the uncommitted changes into the given commit of the stack, rebases the commits above it, and
+// submits the stack again. Only the rewritten commits are pushed. Untracked files are only added when the user says so.
+func amendCommit(args []string) {
+	if len(args) > 1 {
+		exitCodef(ExitConfig, "usage: git pr amend [commit]")
+	}
+	if validateGitStatusClean() {
+		exitCodef(ExitConfig, "no changes to amend")
+	}
+	originMain := fmt.Sprintf("%v/%v", config.Remote, config.MainBranch)
+	stackedCommits := must(getStackedCommits(originMain, head))
+	if len(stackedCommits) == 0 {
+		exitf("no commits to amend")
+	}
+
+	var target *Commit
+	if len(args) == 1 {
+		target = findStackedCommit(stackedCommits, args[0])
+		if target == nil {
+			exitCodef(ExitConfig, "commit %q not found in the stack", args[0])
+		}
+	} else {
+		target = chooseStackedCommit(stackedCommits, "Amend which commit?")
+	}
+
+	fmt.Printf("amend %v\n", target)
+	must(execGit("add", "-u"))
+	// untracked files are often build outputs or notes: only add them when asked to
+	out := must(execGit("ls-files", "-z", "--others", "--exclude-standard"))
+	untracked := strings.FieldsFunc(out, func(r rune) bool { return r == 0 })
+	if len(untracked) > 0 {
+		fmt.Printf("untracked files:\n  %v\n", strings.Join(untracked, "\n  "))
+		if promptYesNo("Add the untracked files to the commit?") {
+			must(execGit(append([]string{"add", "--"}, untracked...)...))
+		}
+	}
+	if _, err := execGit("diff", "--cached", "--quiet"); err == nil {
+		exitCodef(ExitConfig, "no changes to amend\n\nHint: use \"git add\" for the new files")
+	}
+	must(execGit("commit", "--no-verify", "--fixup", target.Hash))
+	_, err := execGit("-c", "sequence.editor=true", "rebase", "--interactive", "--autosquash", target.Hash+"^")
+	if err != nil {
+		exitCodef(ExitConflict, `failed to squash the changes into %v
+
+Hint: resolve the conflicts and run "git rebase --continue", then "git pr"`, target.ShortHash())
+	}
+	submitStack()
+}
+
+// findStackedCommit finds the commit in the stack by hash prefix or Remote-Ref.
+func findStackedCommit(commits []*Commit, ref string) *Commit {
+	for _, commit := range commits {
+		if len(ref) >= 4 && strings.HasPrefix(commit.Hash, ref) || ref != "" && commit.GetRemoteRef() == ref {
+			return commit
+		}
+	}
+	return nil
+}
+
+// chooseStackedCommit asks the user to choose a commit from the stack.
+func chooseStackedCommit(commits []*Commit, question string) *Commit {
+	if !isTerminal(os.Stdin) {
+		exitCodef(ExitConfig, "no commit given and stdin is not a terminal")
+	}
+	for i := len(commits) - 1; i >= 0; i-- {
+		fmt.Printf("%3d. %v\n", i+1, commits[i])
+	}
+	for {
+		answer := promptString(question)
+		n, err := strconv.Atoi(answer)
+		if err == nil && n >= 1 && n <= len(commits) {
+			return commits[n-1]
+		}
+		if commit := findStackedCommit(commits, answer); commit != nil {
+			return commit
+		}
+		fmt.Printf("invalid choice %q\n", answer)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// the "(#123)" suffix which GitHub adds to the title of the squash commits, or "(!123)" from "git pr squash-land" on
+// GitLab
+var regexpSquashPRNumber = regexp.MustCompile(`\((?:#|!)([0-9]+)\)$`)
+
+// annotation is the PR which a commit of the main branch came from.
+type annotation struct {
+	PRNumber  int
+	RemoteRef string
+	Stack     string
+}
+
+// annotateTrunk prints the commits of the main branch (default to the last 50) with the PR and the stack they came
+// from. The squash merges lose the Remote-Ref and Stack trailers of the local commits, so they are looked up in the
+// PRs landed with "git pr squash-land", or from the "(#123)" suffix of the title for the PRs landed elsewhere.
+// With -notes, the annotations are also written as git notes (refs/notes/git-pr), for "git log --notes=git-pr".
+func annotateTrunk(args []string) {
+	originMain := fmt.Sprintf("%v/%v", config.Remote, config.MainBranch)
+	logArgs := []string{"log", "--format=%H %s"}
+	if len(args) == 0 {
+		logArgs = append(logArgs, "-n", "50", originMain)
+	} else {
+		logArgs = append(logArgs, args...)
+	}
+	out, err := execGit(logArgs...)
+	if err != nil {
+		exitCodef(ExitConfig, "usage: git pr annotate [-notes] [<revision range>]\n\n%v", err)
+	}
+
+	landed := map[string]*LandedPR{}
+	for _, pr := range loadLandedPRs() {
+		landed[pr.TrunkSHA] = pr
+	}
+	count := 0
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		hash, title, _ := strings.Cut(line, " ")
+		if hash == "" {
+			continue
+		}
+		ann := annotateCommit(title, landed[hash])
+		if ann == nil {
+			fmt.Printf("%v %-8v %v\n", hash[:8], "", title)
+			continue
+		}
+		count++
+		stack := xif(ann.Stack != "", " ["+ann.Stack+"]", "")
+		fmt.Printf("%v %-8v %v%v\n", hash[:8], forge.PRRef(ann.PRNumber), title, stack)
+		if config.AnnotateNotes {
+			must(execGit("notes", "--ref=git-pr", "add", "-f", "-m", formatAnnotationNote(ann), hash))
+		}
+	}
+	if config.AnnotateNotes && count > 0 {
+		fmt.Printf(`
+wrote %v notes to refs/notes/git-pr: show them with "git log --notes=git-pr", or always with
+"git config --add notes.displayRef refs/notes/git-pr"
+`, count)
+	}
+}
+
+// annotateCommit returns the PR of a commit of the main branch, from its record when it was landed with
+// "git pr squash-land", or from its title; nil when it's unknown.
+func annotateCommit(title string, landed *LandedPR) *annotation {
+	if landed != nil {
+		return &annotation{PRNumber: landed.PRNumber, RemoteRef: landed.RemoteRef, Stack: landed.Stack}
+	}
+	if match := regexpSquashPRNumber.FindStringSubmatch(strings.TrimSpace(title)); match != nil {
+		number, _ := strconv.Atoi(match[1])
+		return &annotation{PRNumber: number}
+	}
+	return nil
+}
+
+// formatAnnotationNote formats the annotation as trailers, like the local commits had.
+func formatAnnotationNote(ann *annotation) string {
+	lines := []string{"Pull-Request: " + forge.PRURL(ann.PRNumber)}
+	if ann.RemoteRef != "" {
+		lines = append(lines, "Remote-Ref: "+ann.RemoteRef)
+	}
+	if ann.Stack != "" {
+		lines = append(lines, "Stack: "+ann.Stack)
+	}
+	return strings.Join(lines, "\n")
+}
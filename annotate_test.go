@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAnnotateCommit(t *testing.T) {
+	landed := &LandedPR{PRNumber: 42, RemoteRef: "oliver/feat/1a2b3c4d", Stack: "feat"}
+	tests := []struct {
+		title  string
+		landed *LandedPR
+		want   string
+	}{
+		{"Add the foo API (#123)", nil, "#123  "},
+		{"Add the foo API (#123)", landed, "#42 oliver/feat/1a2b3c4d feat"},
+		{"Fix #123 in the foo API", nil, ""},
+		{"Merge branch 'release'", nil, ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if ann := annotateCommit(tt.title, tt.landed); ann != nil {
+			got = fmt.Sprintf("#%v %v %v", ann.PRNumber, ann.RemoteRef, ann.Stack)
+		}
+		if got != tt.want {
+			t.Errorf("annotateCommit(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIStats counts the GitHub API requests of a run by category, with the remaining quota after the last request.
+type APIStats struct {
+	Time      time.Time      `json:"time"`
+	Command   string         `json:"command"`
+	Counts    map[string]int `json:"counts"`
+	Remaining int            `json:"remaining"` // -1 when unknown
+	Limit     int            `json:"limit"`
+}
+
+var (
+	apiStats   = APIStats{Counts: map[string]int{}, Remaining: -1}
+	apiStatsMu sync.Mutex
+)
+
+var regexpAPIPathID = regexp.MustCompile(`/([0-9]+|[0-9a-f]{40})(/|$)`)
+
+// apiCategory groups the API requests by method and path, with the repository and ids removed, e.g.
+// "GET pulls/:id/reviews".
+func apiCategory(method, url string) string {
+	path := url
+	if _, after, ok := strings.Cut(url, "/repos/"+config.Repo+"/"); ok {
+		path = after
+	} else if idx := strings.Index(url, "://"); idx >= 0 {
+		_, path, _ = strings.Cut(url[idx+3:], "/")
+	}
+	path, _, _ = strings.Cut(path, "?")
+	for regexpAPIPathID.MatchString(path) {
+		path = regexpAPIPathID.ReplaceAllString(path, "/:id$2")
+	}
+	return method + " " + path
+}
+
+func countAPIRequest(category string, header http.Header) {
+	apiStatsMu.Lock()
+	defer apiStatsMu.Unlock()
+	apiStats.Counts[category]++
+	if header == nil {
+		return
+	}
+	if remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining")); err == nil {
+		apiStats.Remaining = remaining
+		apiStats.Limit, _ = strconv.Atoi(header.Get("X-RateLimit-Limit"))
+	}
+}
+
+// recordAPIStats appends the API usage of the run to .git/git-pr/api-stats.jsonl, and prints it with -api. It's an
+// exit hook, to record the failed runs too.
+func recordAPIStats() {
+	apiStatsMu.Lock()
+	defer apiStatsMu.Unlock()
+	if len(apiStats.Counts) == 0 {
+		return
+	}
+	apiStats.Time = time.Now()
+	apiStats.Command = coalesce(config.Command, "submit")
+	if config.APIStats {
+		fmt.Printf("\n%v\n", formatAPIStats(apiStats))
+	}
+	f, err := os.OpenFile(filepath.Join(gitPRDir(), "api-stats.jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		debugf("failed to record api stats (ignored): %v\n", err)
+		return
+	}
+	defer f.Close()
+	fprint(f, string(must(json.Marshal(apiStats))), "\n")
+}
+
+func formatAPIStats(stats APIStats) string {
+	var b strings.Builder
+	total := 0
+	categories := make([]string, 0, len(stats.Counts))
+	for category, count := range stats.Counts {
+		total += count
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		ci, cj := stats.Counts[categories[i]], stats.Counts[categories[j]]
+		return ci > cj || ci == cj && categories[i] < categories[j]
+	})
+	fprintf(&b, "%v requests", total)
+	if stats.Remaining >= 0 {
+		fprintf(&b, ", %v/%v quota remaining", stats.Remaining, stats.Limit)
+	}
+	for _, category := range categories {
+		fprintf(&b, "\n  %5v  %v", stats.Counts[category], category)
+	}
+	return b.String()
+}
+
+// showAPIStats summarizes the recorded API usage by command.
+func showAPIStats(args []string) {
+	if len(args) > 0 || !config.APIStats {
+		exitCodef(ExitConfig, "usage: git pr stats -api")
+	}
+	f, err := os.Open(filepath.Join(gitPRDir(), "api-stats.jsonl"))
+	if os.IsNotExist(err) {
+		exitf("no api stats recorded yet")
+	}
+	must(0, err)
+	defer f.Close()
+
+	type summary struct {
+		Runs, Total, Max int
+		Last             APIStats
+		Counts           map[string]int
+	}
+	summaries := map[string]*summary{}
+	var commands []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var stats APIStats
+		if json.Unmarshal(scanner.Bytes(), &stats) != nil {
+			continue
+		}
+		s := summaries[stats.Command]
+		if s == nil {
+			s = &summary{Counts: map[string]int{}}
+			summaries[stats.Command] = s
+			commands = append(commands, stats.Command)
+		}
+		total := 0
+		for category, count := range stats.Counts {
+			total += count
+			s.Counts[category] += count
+		}
+		s.Runs++
+		s.Total += total
+		s.Max = xif(total > s.Max, total, s.Max)
+		s.Last = stats
+	}
+	must(0, scanner.Err())
+
+	sort.Strings(commands)
+	for _, command := range commands {
+		s := summaries[command]
+		fmt.Printf("%v: %v runs, %v requests on average, %v at most, last run %v\n",
+			command, s.Runs, s.Total/s.Runs, s.Max, s.Last.Time.Format("2006-01-02 15:04"))
+		fmt.Println(formatAPIStats(APIStats{Counts: s.Counts, Remaining: s.Last.Remaining, Limit: s.Last.Limit}))
+		fmt.Println()
+	}
+}
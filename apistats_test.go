@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestAPICategory(t *testing.T) {
+	config.Repo = "owner/repo"
+	tests := []struct {
+		method, url, want string
+	}{
+		{"GET", "https://api.github.com/repos/owner/repo/pulls/12/reviews", "GET pulls/:id/reviews"},
+		{"GET", "https://api.github.com/repos/owner/repo/pulls?state=open&head=owner:me/1", "GET pulls"},
+		{"GET", "https://api.github.com/repos/owner/repo/commits/0123456789abcdef0123456789abcdef01234567/check-runs?per_page=100", "GET commits/:id/check-runs"},
+		{"PATCH", "https://api.github.com/repos/owner/repo/issues/12", "PATCH issues/:id"},
+		{"GET", "https://api.github.com/user", "GET user"},
+	}
+	for _, tt := range tests {
+		if got := apiCategory(tt.method, tt.url); got != tt.want {
+			t.Errorf("apiCategory(%v %v) = %q, want %q", tt.method, tt.url, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// appToken is the installation token of the GitHub App (git config git-pr.app-id and git-pr.app-private-key), or the
+// output of git config git-pr.token-command. It's minted on the first request and refreshed before it expires, or
+// when GitHub rejects it.
+var appToken struct {
+	sync.Mutex
+	token     string
+	expiresAt time.Time // zero when unknown, for the token command
+	mintedAt  time.Time
+}
+
+func isAppAuth() bool {
+	return config.AppID != "" || config.TokenCommand != ""
+}
+
+// githubToken returns the token for the API requests and the pushes.
+func githubToken() string {
+	if !isAppAuth() {
+		return config.Token
+	}
+	appToken.Lock()
+	defer appToken.Unlock()
+	if appToken.token == "" || (!appToken.expiresAt.IsZero() && time.Until(appToken.expiresAt) < 5*time.Minute) {
+		mintAppToken()
+	}
+	return appToken.token
+}
+
+// refreshAppToken mints a new token after GitHub rejected the current one. It returns false when there is nothing to
+// refresh, or the token is brand new, to not retry forever.
+func refreshAppToken() bool {
+	if !isAppAuth() {
+		return false
+	}
+	appToken.Lock()
+	defer appToken.Unlock()
+	if time.Since(appToken.mintedAt) < time.Minute {
+		return false
+	}
+	mintAppToken()
+	return true
+}
+
+func mintAppToken() {
+	if config.TokenCommand != "" {
+		out, err := execCommand("sh", "-c", config.TokenCommand)
+		if err != nil || strings.TrimSpace(out) == "" {
+			exitCodef(ExitAuth, "failed to get a token from %v: %v", gitconfigTokenCommand, err)
+		}
+		appToken.token, appToken.expiresAt = strings.TrimSpace(out), time.Time{}
+	} else {
+		token, expiresAt, err := createInstallationToken()
+		if err != nil {
+			exitCodef(ExitAuth, "failed to create an installation token for the GitHub App %v: %v\n\nHint: check %v and %v, and that the app is installed on %v",
+				config.AppID, err, gitconfigAppID, gitconfigAppPrivateKey, config.Repo)
+		}
+		appToken.token, appToken.expiresAt = token, expiresAt
+	}
+	appToken.mintedAt = time.Now()
+}
+
+// createInstallationToken authenticates as the app with a JWT signed by its private key, finds its installation on the
+// repository (unless git config git-pr.app-installation-id is set), and creates an installation token.
+func createInstallationToken() (token string, expiresAt time.Time, _ error) {
+	jwt, err := signAppJWT(config.AppID, repoPath(expandPath(config.AppPrivateKey)), time.Now())
+	if err != nil {
+		return "", expiresAt, err
+	}
+	installationID := config.AppInstallationID
+	if installationID == "" {
+		var installation struct {
+			ID int64 `json:"id"`
+		}
+		ghURL := fmt.Sprintf("https://api.%v/repos/%v/installation", config.Host, config.Repo)
+		if err = appRequest("GET", ghURL, jwt, &installation); err != nil {
+			return "", expiresAt, err
+		}
+		installationID = fmt.Sprint(installation.ID)
+	}
+	var out struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	ghURL := fmt.Sprintf("https://api.%v/app/installations/%v/access_tokens", config.Host, installationID)
+	if err = appRequest("POST", ghURL, jwt, &out); err != nil {
+		return "", expiresAt, err
+	}
+	return out.Token, out.ExpiresAt, nil
+}
+
+// appRequest calls the API as the app itself. It can't use httpRequest, which authenticates as the installation.
+func appRequest(method, url, jwt string, out any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	debugf("-> %v %v (as the app)\n", method, url)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &HTTPError{Method: method, URL: url, Status: resp.Status, StatusCode: resp.StatusCode, Body: data}
+	}
+	if err = json.Unmarshal(data, out); err != nil {
+		return errorf("failed to parse request body: %v", err)
+	}
+	return nil
+}
+
+// signAppJWT creates the JWT which authenticates as the GitHub App, valid for 9 minutes. It's issued a minute in the
+// past to allow for clock drift, as GitHub recommends.
+func signAppJWT(appID, keyPath string, now time.Time) (string, error) {
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return "", err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return "", errorf("no PEM data in %v", keyPath)
+	}
+	var key *rsa.PrivateKey
+	if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+		parsed, err8 := x509.ParsePKCS8PrivateKey(block.Bytes)
+		rsaKey, ok := parsed.(*rsa.PrivateKey)
+		if err8 != nil || !ok {
+			return "", errorf("invalid RSA private key in %v: %v", keyPath, err)
+		}
+		key = rsaKey
+	}
+
+	encode := func(v any) string {
+		return base64.RawURLEncoding.EncodeToString(must(json.Marshal(v)))
+	}
+	var b bytes.Buffer
+	b.WriteString(encode(map[string]any{"alg": "RS256", "typ": "JWT"}))
+	b.WriteString(".")
+	b.WriteString(encode(map[string]any{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": appID,
+	}))
+	hash := sha256.Sum256(b.Bytes())
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return b.String() + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// BitbucketPR is a pull request of Bitbucket Cloud.
+type BitbucketPR struct {
+	ID          int    `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	State       string `json:"state"` // OPEN, MERGED, DECLINED, SUPERSEDED
+	Draft       bool   `json:"draft"`
+	Author      struct {
+		Nickname string `json:"nickname"`
+	} `json:"author"`
+	Source struct {
+		Branch struct {
+			Name string `json:"name"`
+		} `json:"branch"`
+		Commit struct {
+			Hash string `json:"hash"` // shortened to 12 characters
+		} `json:"commit"`
+	} `json:"source"`
+	Destination struct {
+		Branch struct {
+			Name string `json:"name"`
+		} `json:"branch"`
+	} `json:"destination"`
+	MergeCommit *struct {
+		Hash string `json:"hash"`
+	} `json:"merge_commit"`
+	UpdatedOn *time.Time `json:"updated_on"`
+}
+
+func (bpr *BitbucketPR) toPR() *PR {
+	pr := &PR{Number: bpr.ID, Title: bpr.Title, Body: bpr.Description, Draft: bpr.Draft, UpdatedAt: bpr.UpdatedOn}
+	pr.State = strings.ToLower(bpr.State)
+	pr.Head.Ref, pr.Head.Sha = bpr.Source.Branch.Name, bpr.Source.Commit.Hash
+	pr.Base.Ref = bpr.Destination.Branch.Name
+	pr.User.Login = bpr.Author.Nickname
+	if bpr.MergeCommit != nil {
+		pr.MergeCommitSHA = bpr.MergeCommit.Hash
+	}
+	return pr
+}
+
+// BitbucketStatus is a build status of a commit, reported by Bitbucket Pipelines or another CI.
+type BitbucketStatus struct {
+	Key       string     `json:"key"`
+	Name      string     `json:"name"`
+	State     string     `json:"state"` // INPROGRESS, SUCCESSFUL, FAILED, STOPPED
+	CreatedOn *time.Time `json:"created_on"`
+	UpdatedOn *time.Time `json:"updated_on"`
+}
+
+// toCheckRun converts the status to a GitHub check run, for waiting on the checks and summarizing them.
+func (s *BitbucketStatus) toCheckRun() CheckRun {
+	run := CheckRun{Name: coalesce(s.Name, s.Key), Status: "completed", StartedAt: s.CreatedOn}
+	switch s.State {
+	case "INPROGRESS":
+		run.Status = "in_progress"
+	case "SUCCESSFUL":
+		run.Conclusion = "success"
+	case "STOPPED":
+		run.Conclusion = "cancelled"
+	default:
+		run.Conclusion = "failure"
+	}
+	if run.Status == "completed" {
+		run.CompletedAt = s.UpdatedOn
+	}
+	return run
+}
+
+type bitbucketForge struct{}
+
+func bitbucketRepoURL() string {
+	return fmt.Sprintf("https://api.bitbucket.org/2.0/repositories/%v", config.Repo)
+}
+
+func (bitbucketForge) PRURL(number int) string {
+	return fmt.Sprintf("https://%v/%v/pull-requests/%v", config.Host, config.Repo, number)
+}
+
+func (bitbucketForge) CommitURL(hash string) string {
+	return fmt.Sprintf("https://%v/%v/commits/%v", config.Host, config.Repo, hash)
+}
+
+func (bitbucketForge) PRRef(number int) string {
+	return fmt.Sprintf("#%v", number)
+}
+
+func (f bitbucketForge) GetPRNumber(commit, prev *Commit) (int, error) {
+	if commit.PRNumber != 0 {
+		return commit.PRNumber, nil
+	}
+	number, err := f.GetPRNumberByHead(commit.GetRemoteRef())
+	if err != nil || number != 0 || commit.Skip {
+		return number, err
+	}
+	// the commit was pushed and got "Everything up-to-date", try creating new pr
+	if err = f.CreatePR(commit, prev); err != nil {
+		return 0, err
+	}
+	return commit.PRNumber, nil
+}
+
+func (bitbucketForge) GetPRNumberByHead(branch string) (int, error) {
+	if branch == "" {
+		return 0, nil
+	}
+	query := fmt.Sprintf(`source.branch.name = %q AND state = "OPEN"`, branch)
+	jsonBody, err := httpGET(fmt.Sprintf("%v/pullrequests?q=%v", bitbucketRepoURL(), url.QueryEscape(query)))
+	if err != nil {
+		return 0, err
+	}
+	var out struct {
+		Values []BitbucketPR `json:"values"`
+	}
+	if err = json.Unmarshal(jsonBody, &out); err != nil {
+		return 0, errorf("failed to parse request body: %v", err)
+	}
+	if len(out.Values) == 0 {
+		return 0, nil
+	}
+	return out.Values[0].ID, nil
+}
+
+func (bitbucketForge) GetPR(number int) (*PR, error) {
+	jsonBody, err := httpGET(fmt.Sprintf("%v/pullrequests/%v", bitbucketRepoURL(), number))
+	if err != nil {
+		return nil, err
+	}
+	var out BitbucketPR
+	if err = json.Unmarshal(jsonBody, &out); err != nil {
+		return nil, errorf("failed to parse request body: %v", err)
+	}
+	return out.toPR(), nil
+}
+
+func bitbucketBranch(name string) map[string]any {
+	return map[string]any{"branch": map[string]any{"name": name}}
+}
+
+func (f bitbucketForge) CreatePR(commit, prev *Commit) error {
+	// another run may have just created the PR for this branch
+	number, err := f.GetPRNumberByHead(commit.GetRemoteRef())
+	if err != nil {
+		return err
+	}
+	if number != 0 {
+		fmt.Printf("pull request #%v already exists for %q\n", number, commit.Title)
+		commit.PRNumber = number
+		return f.updatePR(number, map[string]any{"destination": bitbucketBranch(prBase(prev))})
+	}
+
+	fmt.Printf("create pull request for %q\n", commit.Title)
+	jsonBody, err := httpPOST(bitbucketRepoURL()+"/pullrequests", map[string]any{
+		"title":               commit.Title,
+		"description":         newPRBody(commit),
+		"source":              bitbucketBranch(commit.GetRemoteRef()),
+		"destination":         bitbucketBranch(prBase(prev)),
+		"draft":               regexpDraft.MatchString(commit.Title),
+		"close_source_branch": false,
+	})
+	if err != nil {
+		return err
+	}
+	var out BitbucketPR
+	if err = json.Unmarshal(jsonBody, &out); err != nil {
+		return errorf("failed to parse request body: %v", err)
+	}
+	commit.PRNumber = out.ID
+	return nil
+}
+
+func (f bitbucketForge) UpdateBase(commit, prev *Commit) error {
+	number, err := f.GetPRNumber(commit, prev)
+	if err != nil {
+		return err
+	}
+	return f.updatePR(number, map[string]any{"destination": bitbucketBranch(prBase(prev))})
+}
+
+func (bitbucketForge) updatePR(number int, fields map[string]any) error {
+	_, err := httpRequest("PUT", fmt.Sprintf("%v/pullrequests/%v", bitbucketRepoURL(), number), fields)
+	return err
+}
+
+// UpdatePR also updates the draft state, which is from the title.
+func (f bitbucketForge) UpdatePR(number int, title, body string) error {
+	return f.updatePR(number, map[string]any{"title": title, "description": body, "draft": regexpDraft.MatchString(title)})
+}
+
+// AddLabels does nothing: Bitbucket has no labels.
+func (bitbucketForge) AddLabels(number int, labels ...string) error {
+	debugf("skip labels %v of #%v: Bitbucket has no labels\n", strings.Join(labels, ","), number)
+	return nil
+}
+
+func (bitbucketForge) ListChecks(ref string) ([]CheckRun, error) {
+	jsonBody, err := httpGET(fmt.Sprintf("%v/commit/%v/statuses?pagelen=100", bitbucketRepoURL(), url.PathEscape(ref)))
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Values []BitbucketStatus `json:"values"`
+	}
+	if err = json.Unmarshal(jsonBody, &out); err != nil {
+		return nil, errorf("failed to parse request body: %v", err)
+	}
+	runs := make([]CheckRun, len(out.Values))
+	for i := range out.Values {
+		runs[i] = out.Values[i].toCheckRun()
+	}
+	return runs, nil
+}
+
+// MergePR merges the PR with the "squash" or "merge_commit" strategy. Bitbucket can not refuse to merge when the head
+// changed, so it's checked right before.
+func (f bitbucketForge) MergePR(number int, method, sha, message string) (string, error) {
+	pr, err := f.GetPR(number)
+	if err != nil {
+		return "", err
+	}
+	if pr.Head.Sha == "" || !strings.HasPrefix(sha, pr.Head.Sha) {
+		return "", errorf("the head of #%v changed: %v instead of %v", number, pr.Head.Sha, sha)
+	}
+	jsonBody, err := httpPOST(fmt.Sprintf("%v/pullrequests/%v/merge", bitbucketRepoURL(), number), map[string]any{
+		"merge_strategy":      xif(method == "squash", "squash", "merge_commit"),
+		"message":             message,
+		"close_source_branch": false,
+	})
+	if err != nil {
+		return "", err
+	}
+	var out BitbucketPR
+	if err = json.Unmarshal(jsonBody, &out); err != nil {
+		return "", errorf("failed to parse request body: %v", err)
+	}
+	// large merges complete asynchronously, without the merge commit in the response
+	if out.MergeCommit == nil {
+		return "", errorf("the merge of #%v is still in progress: check it at %v", number, f.PRURL(number))
+	}
+	return out.MergeCommit.Hash, nil // shortened, expanded after fetching the main branch
+}
+
+func (bitbucketForge) DeleteBranch(branch string) error {
+	_, err := httpRequest("DELETE", fmt.Sprintf("%v/refs/branches/%v", bitbucketRepoURL(), url.PathEscape(branch)), nil)
+	return err
+}
+
+func (bitbucketForge) SearchPR(title string) (int, error) {
+	query := fmt.Sprintf(`title = %q AND state = "OPEN"`, title)
+	jsonBody, err := httpGET(fmt.Sprintf("%v/pullrequests?q=%v", bitbucketRepoURL(), url.QueryEscape(query)))
+	if err != nil {
+		return 0, err
+	}
+	var out struct {
+		Values []BitbucketPR `json:"values"`
+	}
+	if err = json.Unmarshal(jsonBody, &out); err != nil {
+		return 0, errorf("failed to parse request body: %v", err)
+	}
+	if len(out.Values) == 0 {
+		return 0, nil
+	}
+	return out.Values[0].ID, nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBitbucketStatusToCheckRun(t *testing.T) {
+	updated := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		state          string
+		wantStatus     string
+		wantConclusion string
+		wantCompleted  bool
+	}{
+		{"INPROGRESS", "in_progress", "", false},
+		{"SUCCESSFUL", "completed", "success", true},
+		{"FAILED", "completed", "failure", true},
+		{"STOPPED", "completed", "cancelled", true},
+	}
+	for _, tt := range tests {
+		run := (&BitbucketStatus{Key: "build", State: tt.state, UpdatedOn: &updated}).toCheckRun()
+		if run.Name != "build" || run.Status != tt.wantStatus || run.Conclusion != tt.wantConclusion || (run.CompletedAt != nil) != tt.wantCompleted {
+			t.Errorf("toCheckRun(%v) = %+v", tt.state, run)
+		}
+	}
+}
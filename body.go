@@ -0,0 +1,356 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// defaultBodyTemplate is used for the PR body when neither the PR body nor the commit message is set. Override it with
+// a template file in git config git-pr.template. See BodyTemplateData for the available variables.
+const defaultBodyTemplate = `
+# {{localize "Summary"}}
+
+<br>
+<br>
+<br>
+<br>
+`
+
+// BodyTemplateData is passed to the PR body template.
+type BodyTemplateData struct {
+	Title string
+	Stats CommitStats
+}
+
+var bodyTemplateFuncs = template.FuncMap{
+	"join":     strings.Join,
+	"localize": localize,
+}
+
+// generatePRBody generates the body of the PR for the commit:
+//   - if the user edited the body on github, keep the body (+ commit message)
+//   - if the user didn't edit the body, but set the commit message, keep the commit message
+//   - if the user didn't edit the body and didn't set the commit message, use the default template
+//
+// followed by the sections from git config git-pr.body-sections: by default the scope of the commit, and the list of
+// PRs in the stack (when there is more than one).
+func generatePRBody(commit *Commit, prBody string, stackedCommits []*Commit) string {
+	parsedBody := func() string {
+		footerIndex := prDelimiterRegexp.FindStringIndex(prBody)
+		if len(footerIndex) > 0 {
+			startIdx := footerIndex[0]
+			return strings.TrimSpace(prBody[:startIdx])
+		}
+		if config.Mapping == mappingGhstack {
+			return strings.TrimSpace(stripGhstackHeader(prBody))
+		}
+		return prBody
+	}()
+	data := &bodySectionData{Commit: commit, StackedCommits: stackedCommits, Stats: must(getCommitStats(commit.Hash))}
+
+	var bodyB strings.Builder
+	prf := func(msg string, args ...any) { fprintf(&bodyB, msg, args...) }
+	head, hasHead := parsedBody, parsedBody != ""
+	if !hasHead && commit.Message == "" {
+		head, hasHead = describeCommit(commit), true
+		if head == "" {
+			head = renderBodyTemplate(BodyTemplateData{Title: commit.Title, Stats: data.Stats})
+		}
+	}
+	messageAbove := !hasHead && containsString(config.BodySections, "message") // the message is the description
+	if hasHead {
+		prf("%v\n\n\n\n\n\n\n\n", head)
+	}
+	prf("%v\n\n", prDelimiterToGenerated)
+	if messageAbove {
+		prf("%v", renderBodySection("message", data))
+	}
+	prf("---\n\n")
+	for _, name := range config.BodySections {
+		if name != "message" || !messageAbove {
+			prf("%v", renderBodySection(name, data))
+		}
+	}
+	return bodyB.String()
+}
+
+// newPRBody returns the body of a new PR. The stack list is added when updating the PRs, with the numbers of the other
+// PRs of the stack.
+func newPRBody(commit *Commit) string {
+	return generatePRBody(commit, "", []*Commit{commit})
+}
+
+// bodySectionData is passed to the sections of the generated part of the PR body.
+type bodySectionData struct {
+	Commit         *Commit
+	StackedCommits []*Commit
+	Stats          CommitStats
+}
+
+// bodySections are the built-in sections of the generated part of the PR body. Each returns its markdown, followed
+// by an empty line, or "" to be skipped.
+var bodySections = map[string]func(data *bodySectionData) string{
+	"message":    messageSection,
+	"test-plan":  testPlanSection,
+	"scope":      scopeSection,
+	"submodules": submodulesSection,
+	"co-review":  coReviewSection,
+	"stack":      stackSection,
+}
+
+const defaultBodySections = "message,test-plan,scope,submodules,co-review,stack"
+
+// renderBodySection renders a built-in section, or a custom one from the output of the command in git config
+// git-pr.body-section.<name>, which receives the commit (message and diff) on stdin.
+func renderBodySection(name string, data *bodySectionData) string {
+	if section := bodySections[name]; section != nil {
+		return section(data)
+	}
+	command := config.BodySectionCommands[name]
+	patch := must(execGit("show", "--format=%B", data.Commit.Hash))
+	out, err := execCommandWithInput(patch, "sh", "-c", command)
+	out = strings.TrimSpace(out)
+	if err != nil {
+		fmt.Printf("failed to render the %v section of %v (ignored): %v\n", name, data.Commit.ShortHash(), err)
+		return ""
+	}
+	if out == "" {
+		return ""
+	}
+	return out + "\n\n"
+}
+
+func messageSection(data *bodySectionData) string {
+	return fmt.Sprintf("%v\n\n", formatMessage(data.Commit.Message))
+}
+
+func scopeSection(data *bodySectionData) string {
+	s := data.Stats
+	stats := fmt.Sprintf(localize("%v files changed (+%v -%v) in %v"), s.Files, s.Insertions, s.Deletions, strings.Join(s.Dirs, ", "))
+	return fmt.Sprintf("**%v:** %v\n\n", localize("Scope"), stats)
+}
+
+func testPlanSection(data *bodySectionData) string {
+	testPlan := data.Commit.GetAttr(KeyTestPlan)
+	if testPlan == "" {
+		return ""
+	}
+	return fmt.Sprintf("**%v:** %v\n\n", localize("Test plan"), testPlan)
+}
+
+func submodulesSection(data *bodySectionData) string {
+	if !data.Stats.OnlySubmodules() {
+		return ""
+	}
+	var bumps []string
+	for _, sm := range data.Stats.Submodules {
+		bumps = append(bumps, fmt.Sprintf("`%v` %v → %v", sm.Path, submoduleHash(sm.Old), submoduleHash(sm.New)))
+	}
+	return fmt.Sprintf("**%v:** %v\n\n", localize("Submodules only"), strings.Join(bumps, ", "))
+}
+
+func coReviewSection(data *bodySectionData) string {
+	coReviews := getCoReviews(data.Commit)
+	if len(coReviews) == 0 {
+		return ""
+	}
+	return formatCoReviews(coReviews) + "\n"
+}
+
+// stackSection lists the PRs of the stack:
+//   - for the current PR with an emoji, mark with an emoji and point to the commit
+//   - for other PRs, if it's from the author, use the PR number
+//   - otherwise, use the commit title and hash
+func stackSection(data *bodySectionData) string {
+	commit := data.Commit
+	if len(data.StackedCommits) == 1 {
+		return "" // no stack to list
+	}
+	var bodyB strings.Builder
+	prf := func(msg string, args ...any) { fprintf(&bodyB, msg, args...) }
+	for _, cm := range data.StackedCommits {
+		var cmRef string
+		cmURL := forge.CommitURL(cm.ShortHash())
+		switch {
+		case cm.PRNumber != 0 && cm.Hash == commit.Hash:
+			cmRef = fmt.Sprintf("%v (%v[%v](%v))", forge.PRRef(cm.PRNumber), xif(len(emojisx) == 0, "", "👉"), cm.ShortHash(), cmURL)
+		case cm.PRNumber != 0:
+			cmRef = forge.PRRef(cm.PRNumber)
+		case config.PlainMarkup:
+			author := formatAuthor(cm.AuthorEmail, "\u200B")
+			cmRef = fmt.Sprintf("[%v (%v)](%v) · _%v_", cm.Title, cm.ShortHash(), cmURL, author)
+		default:
+			author := formatAuthor(cm.AuthorEmail, "&#x200B;")
+			cmRef = fmt.Sprintf(`&nbsp;&nbsp;&nbsp;&nbsp;&nbsp;<b>[%v (%v)](%v)</b>&nbsp;&nbsp; ${\textsf{\color{lightblue}· %v}}$`, cm.Title, cm.ShortHash(), cmURL, author)
+		}
+		switch {
+		case len(emojisx) == 0 && cm.Hash == commit.Hash:
+			prf("* ->")
+		case len(emojisx) == 0:
+			prf("* [ ]")
+		case cm.Hash == commit.Hash:
+			prf("* " + emojisx[commit.PRNumber%len(emojisx)])
+		default:
+			prf("* ◻️")
+		}
+		prf(" %v\n", cmRef)
+	}
+	return bodyB.String()
+}
+
+// formatMessage prepares the commit message for the PR body, with git config git-pr.reflow and
+// git-pr.escape-references.
+func formatMessage(message string) string {
+	if config.Reflow {
+		message = reflowMessage(message)
+	}
+	if config.EscapeReferences {
+		message = escapeReferences(message)
+	}
+	return message
+}
+
+var regexpMarkdownBlock = regexp.MustCompile(`^\s*([-*+]|[0-9]+[.)])\s|^\s*(#|>|\|)`)
+var regexpMarkdownListItem = regexp.MustCompile(`^\s*([-*+]|[0-9]+[.)])\s`)
+
+// reflowMessage joins the lines of the paragraphs and list items of a commit message wrapped at 72 columns, as GitHub
+// renders each line break of a PR body. Code blocks, headings, quotes, tables, and hard line breaks are kept as is.
+func reflowMessage(message string) string {
+	var out []string
+	inFence := false
+	joinable := false // whether the next line can continue the previous one
+	for _, line := range strings.Split(message, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			inFence = !inFence
+			out, joinable = append(out, line), false
+		case inFence || trimmed == "":
+			out, joinable = append(out, line), false
+		case !joinable && (strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t")):
+			out = append(out, line) // indented code
+		case regexpMarkdownBlock.MatchString(line):
+			out, joinable = append(out, line), regexpMarkdownListItem.MatchString(line)
+		case joinable:
+			out[len(out)-1] += " " + trimmed
+		default:
+			out, joinable = append(out, line), true
+		}
+		if strings.HasSuffix(line, "  ") || strings.HasSuffix(line, "\\") {
+			joinable = false // hard line break
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+var (
+	regexpReference      = regexp.MustCompile(`(^|[^\w/@&#])([#@])([0-9]+\b|[A-Za-z0-9][A-Za-z0-9-]*)`)
+	regexpClosingKeyword = regexp.MustCompile(`(?i)\b(close[sd]?|fix(e[sd])?|resolve[sd]?)\s*:?\s*$`)
+	regexpCarbonCopyLine = regexp.MustCompile(`(?i)^\s*cc\b`)
+	regexpIssueNumber    = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// escapeReferences inserts a zero-width space in the issue references ("#123") and mentions ("@name") of a commit
+// message, which would otherwise link random issues and notify people. The references meant by the author are kept:
+// after a closing keyword ("Fixes #123"), on "cc" lines ("cc @alice"), and qualified ones ("owner/repo#123"). Code is
+// not changed.
+func escapeReferences(message string) string {
+	lines := strings.Split(message, "\n")
+	inFence := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		if inFence || strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t") || regexpCarbonCopyLine.MatchString(line) {
+			continue
+		}
+		parts := strings.Split(line, "`")
+		for j := 0; j < len(parts); j += 2 { // the odd parts are code spans
+			parts[j] = escapeReferencesInText(parts[j])
+		}
+		lines[i] = strings.Join(parts, "`")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func escapeReferencesInText(text string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range regexpReference.FindAllStringSubmatchIndex(text, -1) {
+		sign, name := text[m[4]:m[5]], text[m[6]:m[7]]
+		intentional := sign == "#" && regexpClosingKeyword.MatchString(text[:m[4]])
+		if intentional || sign == "#" && !regexpIssueNumber.MatchString(name) {
+			continue // not an issue reference
+		}
+		b.WriteString(text[last:m[5]])
+		b.WriteString("\u200B") // zero-width space to prevent creating the link
+		last = m[5]
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// submoduleHash shortens the commit of a submodule, "none" when it's added or removed.
+func submoduleHash(hash string) string {
+	if hash == "" {
+		return "none"
+	}
+	return hash[:8]
+}
+
+func renderBodyTemplate(data BodyTemplateData) string {
+	tmpl, err := template.New("body").Funcs(bodyTemplateFuncs).Parse(config.BodyTemplate)
+	if err != nil {
+		exitCodef(ExitConfig, "invalid body template: %v", err)
+	}
+	var b strings.Builder
+	if err = tmpl.Execute(&b, data); err != nil {
+		exitCodef(ExitConfig, "invalid body template: %v", err)
+	}
+	return b.String()
+}
+
+// describeCommit pipes the commit (with its diff) to the user-configured describe command, for generating the summary
+// of commits without a message. It returns "" when not configured or the command fails.
+func describeCommit(commit *Commit) string {
+	if config.DescribeCommand == "" || commit.Message != "" {
+		return ""
+	}
+	patch := must(execGit("show", "--format=%B", commit.Hash))
+	out, err := execCommandWithInput(patch, "sh", "-c", config.DescribeCommand)
+	out = strings.TrimSpace(out)
+	if err != nil || out == "" {
+		fmt.Printf("failed to describe %v with %v (ignored): %v\n", commit.ShortHash(), gitconfigDescribeCommand, err)
+		return ""
+	}
+	// the command itself is not shown: it may have paths, model names, or flags that are not for the reviewers
+	return fmt.Sprintf("# %v\n\n> [!NOTE]\n> %v\n\n%v", localize("Summary"), localize("Generated description"), out)
+}
+
+// resolveMilestone returns the milestone for the PRs from git config git-pr.milestone: its title, or "@<path>" to use
+// the content of a file on the main branch (e.g. "@VERSION"), so that it rolls over with the releases. It returns nil
+// when not configured or not found.
+func resolveMilestone() *Milestone {
+	title := config.Milestone
+	if path, ok := strings.CutPrefix(title, "@"); ok {
+		originMain := fmt.Sprintf("%v/%v", config.Remote, config.MainBranch)
+		out, err := execGit("show", originMain+":"+path)
+		if err != nil {
+			fmt.Printf("failed to read %v from %v for the milestone (ignored)\n", path, originMain)
+			return nil
+		}
+		title = strings.TrimSpace(out)
+	}
+	if title == "" {
+		return nil
+	}
+	milestone := must(githubFindMilestone(title))
+	if milestone == nil {
+		fmt.Printf("milestone %q not found (ignored)\n", title)
+	}
+	return milestone
+}
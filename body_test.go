@@ -0,0 +1,55 @@
+package main
+
+import "testing"
+
+func TestReflowMessage(t *testing.T) {
+	message := `The parser reported the position of the token
+instead of the position of the error.
+
+- keep the offset of the error
+  in the state
+- report it
+
+` + "```" + `
+parse(src)
+  .check()
+` + "```" + `
+
+    indented code
+    stays
+
+Line with a hard break  
+stays too.`
+	want := `The parser reported the position of the token instead of the position of the error.
+
+- keep the offset of the error in the state
+- report it
+
+` + "```" + `
+parse(src)
+  .check()
+` + "```" + `
+
+    indented code
+    stays
+
+Line with a hard break  
+stays too.`
+	if got := reflowMessage(message); got != want {
+		t.Errorf("reflowMessage() =\n%v", got)
+	}
+}
+
+func TestEscapeReferences(t *testing.T) {
+	message := "Retry #2 of the flaky fix, reported by @alice.\n" +
+		"Fixes #123, see acme/app#45 and dev@acme.com.\n" +
+		"Use `@Override` and `#1`.\n" +
+		"cc @bob"
+	want := "Retry #\u200B2 of the flaky fix, reported by @\u200Balice.\n" +
+		"Fixes #123, see acme/app#45 and dev@acme.com.\n" +
+		"Use `@Override` and `#1`.\n" +
+		"cc @bob"
+	if got := escapeReferences(message); got != want {
+		t.Errorf("escapeReferences() = %q", got)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// checkHistory is the number of recent commits of the main branch whose checks tell how long the checks usually take.
+const checkHistory = 5
+
+// checkDurations returns how long each check usually takes: the median of its successful runs on the latest commits of
+// the main branch, which are listed concurrently.
+func checkDurations() map[string]time.Duration {
+	originMain := fmt.Sprintf("%v/%v", config.Remote, config.MainBranch)
+	out, err := execGit("rev-list", "--first-parent", "-n", fmt.Sprint(checkHistory), originMain)
+	if err != nil {
+		debugf("failed to list the commits of %v (ignored): %v\n", originMain, err)
+		return map[string]time.Duration{}
+	}
+	hashes := strings.Fields(out)
+	history := make([][]CheckRun, len(hashes))
+	var wg sync.WaitGroup
+	for i, hash := range hashes {
+		i, hash := i, hash
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runs, err := forge.ListChecks(hash)
+			if err != nil {
+				debugf("failed to list check runs of %v (ignored): %v\n", hash, err)
+			}
+			history[i] = runs
+		}()
+	}
+	wg.Wait()
+	return medianDurations(history)
+}
+
+// medianDurations returns the median duration of the successful runs of each check.
+func medianDurations(history [][]CheckRun) map[string]time.Duration {
+	all := map[string][]time.Duration{}
+	for _, runs := range history {
+		for _, run := range runs {
+			if d := run.Duration(); d > 0 && run.Conclusion == "success" {
+				all[run.Name] = append(all[run.Name], d)
+			}
+		}
+	}
+	durations := map[string]time.Duration{}
+	for name, list := range all {
+		sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+		durations[name] = list[len(list)/2]
+	}
+	return durations
+}
+
+// summarizeChecks summarizes the check runs, with the elapsed time of the running checks and how long they usually
+// take, e.g. "3 passed, 1 failed (lint), build: running 4m, usually ~9m".
+func summarizeChecks(runs []CheckRun, usual map[string]time.Duration, now time.Time) string {
+	if len(runs) == 0 {
+		return ""
+	}
+	var passed int
+	var failed, queued, running []string
+	for _, run := range runs {
+		switch {
+		case run.Status == "queued":
+			queued = append(queued, run.Name)
+		case run.Status != "completed":
+			desc := run.Name + ": running"
+			if run.StartedAt != nil {
+				desc += " " + formatDuration(now.Sub(*run.StartedAt))
+			}
+			if d, ok := usual[run.Name]; ok {
+				desc += ", usually ~" + formatDuration(d)
+			}
+			running = append(running, desc)
+		case isCheckPassed(run):
+			passed++
+		default:
+			failed = append(failed, run.Name)
+		}
+	}
+	var parts []string
+	if passed > 0 {
+		parts = append(parts, fmt.Sprintf("%v passed", passed))
+	}
+	if len(failed) > 0 {
+		parts = append(parts, fmt.Sprintf("%v failed (%v)", len(failed), strings.Join(failed, ", ")))
+	}
+	if len(queued) > 0 {
+		parts = append(parts, fmt.Sprintf("%v queued", len(queued)))
+	}
+	parts = append(parts, running...)
+	return strings.Join(parts, ", ")
+}
+
+func formatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%vs", int(d/time.Second))
+	}
+	return fmt.Sprintf("%vm", int(d/time.Minute))
+}
+
+// latestCheckRuns keeps the latest run of each check, as a check may run several times on the same commit (re-runs,
+// base changes).
+func latestCheckRuns(runs []CheckRun) (out []CheckRun) {
+	index := map[string]int{}
+	for _, run := range runs {
+		i, ok := index[run.Name]
+		switch {
+		case !ok:
+			index[run.Name] = len(out)
+			out = append(out, run)
+		case run.StartedAt != nil && (out[i].StartedAt == nil || run.StartedAt.After(*out[i].StartedAt)):
+			out[i] = run
+		}
+	}
+	return out
+}
+
+// hasCheckRunsSince reports whether any check started (or is still queued) since the time.
+func hasCheckRunsSince(runs []CheckRun, since time.Time) bool {
+	for _, run := range runs {
+		if run.Status == "queued" || run.StartedAt != nil && !run.StartedAt.Before(since) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMedianDurations(t *testing.T) {
+	run := func(name, conclusion string, minutes int) CheckRun {
+		start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		end := start.Add(time.Duration(minutes) * time.Minute)
+		return CheckRun{Name: name, Status: "completed", Conclusion: conclusion, StartedAt: &start, CompletedAt: &end}
+	}
+	history := [][]CheckRun{
+		{run("build", "success", 9), run("lint", "success", 1)},
+		{run("build", "success", 30), run("lint", "failure", 5)},
+		{run("build", "success", 8)},
+		nil, // the checks could not be listed
+	}
+	got := medianDurations(history)
+	if got["build"] != 9*time.Minute || got["lint"] != time.Minute || len(got) != 2 {
+		t.Errorf("medianDurations() = %v, want build 9m and lint 1m", got)
+	}
+}
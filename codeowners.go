@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var codeOwnersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+type codeOwnersRule struct {
+	Pattern *regexp.Regexp
+	Owners  []string
+}
+
+// loadCodeOwners reads the CODEOWNERS file of the main branch, which is the one GitHub uses for PRs targeting it.
+func loadCodeOwners() []codeOwnersRule {
+	for _, path := range codeOwnersPaths {
+		content, err := execGit("show", fmt.Sprintf("%v/%v:%v", config.Remote, config.MainBranch, path))
+		if err == nil {
+			return parseCodeOwners(content)
+		}
+	}
+	return nil
+}
+
+func parseCodeOwners(content string) (rules []codeOwnersRule) {
+	for _, line := range strings.Split(content, "\n") {
+		if idx := strings.IndexByte(line, '#'); idx >= 0 {
+			line = line[:idx]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		rules = append(rules, codeOwnersRule{
+			Pattern: codeOwnersPattern(fields[0]),
+			Owners:  fields[1:],
+		})
+	}
+	return rules
+}
+
+// codeOwnersPattern converts a CODEOWNERS pattern to a regexp matching file paths:
+//   - "*.js" matches files at any depth
+//   - "/docs/" and "docs/" match everything under the directory, anchored at the root or at any depth
+//   - "docs/*" matches the files directly under docs, but not deeper
+func codeOwnersPattern(pattern string) *regexp.Regexp {
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	pattern = strings.Trim(pattern, "/")
+	lastSegment := pattern[strings.LastIndexByte(pattern, '/')+1:]
+
+	var b strings.Builder
+	b.WriteString(xif(anchored, "^", "^(?:.*/)?"))
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			b.WriteString("[^/]*")
+		case pattern[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	if !strings.Contains(lastSegment, "*") || lastSegment == "**" {
+		b.WriteString("(?:/.*)?") // a directory matches everything under it
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// matchCodeOwners returns the owners of the file. The last matching rule wins.
+func matchCodeOwners(rules []codeOwnersRule, path string) []string {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if rules[i].Pattern.MatchString(path) {
+			return rules[i].Owners
+		}
+	}
+	return nil
+}
+
+// getCodeOwnersOfCommit returns the owners of the files changed by the commit.
+func getCodeOwnersOfCommit(rules []codeOwnersRule, hash string) (owners []string) {
+	if len(rules) == 0 {
+		return nil
+	}
+	out := must(execGit("show", "--name-only", "--format=", hash))
+	seen := map[string]bool{}
+	for _, path := range strings.Split(out, "\n") {
+		if path == "" {
+			continue
+		}
+		for _, owner := range matchCodeOwners(rules, path) {
+			if !seen[owner] {
+				seen[owner] = true
+				owners = append(owners, owner)
+			}
+		}
+	}
+	return owners
+}
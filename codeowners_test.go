@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestMatchCodeOwners(t *testing.T) {
+	rules := parseCodeOwners(`
+# comment
+*            @global
+*.js         @js-owner
+/docs/       @docs
+apps/        @apps
+scripts/*    @scripts   # direct children only
+/build/logs/ @org/build
+`)
+	tests := []struct {
+		path  string
+		owner string
+	}{
+		{"README.md", "@global"},
+		{"web/main.js", "@js-owner"},
+		{"docs/guide/intro.md", "@docs"},
+		{"src/docs/intro.md", "@global"},
+		{"src/apps/main.go", "@apps"},
+		{"scripts/build.sh", "@scripts"},
+		{"scripts/ci/build.sh", "@global"},
+		{"build/logs/out.log", "@org/build"},
+	}
+	for _, tt := range tests {
+		owners := matchCodeOwners(rules, tt.path)
+		if len(owners) != 1 || owners[0] != tt.owner {
+			t.Errorf("matchCodeOwners(%q) = %v, want [%v]", tt.path, owners, tt.owner)
+		}
+	}
+}
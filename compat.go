@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// toolRequirement is the minimum version of a tool which git-pr runs, and what needs it.
+type toolRequirement struct {
+	Name    string
+	Command []string // prints the version
+	Min     string
+	Reason  string
+}
+
+// compatMatrix lists the tools git-pr runs, with the oldest versions known to work.
+var compatMatrix = []toolRequirement{
+	{Name: "git", Command: []string{"git", "--version"}, Min: "2.24.0", Reason: "required by git-branchless"},
+	{Name: "git-branchless", Command: []string{"git-branchless", "--version"}, Min: "0.4.0", Reason: `"git reword" to add the Remote-Ref trailers`},
+}
+
+// toolVersion is the version of a tool found in PATH, cached in .git/git-pr/compat.json until the executable changes.
+type toolVersion struct {
+	Path    string    `json:"path"`
+	ModTime time.Time `json:"mod_time"`
+	Version string    `json:"version"`
+}
+
+func compatCachePath() string {
+	return filepath.Join(gitPRDir(), "compat.json")
+}
+
+var regexpVersion = regexp.MustCompile(`\d+\.\d+(\.\d+)?`)
+
+// parseVersion returns the first version number in the output of "--version", or nil if none.
+func parseVersion(out string) []int {
+	match := regexpVersion.FindString(out)
+	if match == "" {
+		return nil
+	}
+	var version []int
+	for _, part := range strings.Split(match, ".") {
+		n, _ := strconv.Atoi(part)
+		version = append(version, n)
+	}
+	return version
+}
+
+// compareVersions returns -1, 0, or 1 when a is older than, the same as, or newer than b. Missing parts count as 0.
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		x, y := 0, 0
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			return xif(x < y, -1, 1)
+		}
+	}
+	return 0
+}
+
+// findToolVersions runs "--version" of each tool of the matrix, or reads it from the cache when the executable did not
+// change. The version is "" when the tool is not found.
+func findToolVersions() map[string]*toolVersion {
+	cache := map[string]*toolVersion{}
+	if data, err := os.ReadFile(compatCachePath()); err == nil {
+		_ = json.Unmarshal(data, &cache)
+	}
+	out := map[string]*toolVersion{}
+	changed := false
+	for _, req := range compatMatrix {
+		path, err := exec.LookPath(req.Command[0])
+		if err != nil {
+			out[req.Name] = &toolVersion{}
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			out[req.Name] = &toolVersion{Path: path}
+			continue
+		}
+		if cached := cache[req.Name]; cached != nil && cached.Path == path && cached.ModTime.Equal(info.ModTime()) {
+			out[req.Name] = cached
+			continue
+		}
+		result, err := execCommand(req.Command[0], req.Command[1:]...)
+		if err != nil {
+			debugf("failed to get the version of %v (ignored): %v\n", req.Name, err)
+		}
+		version := regexpVersion.FindString(result)
+		out[req.Name] = &toolVersion{Path: path, ModTime: info.ModTime(), Version: version}
+		cache[req.Name], changed = out[req.Name], true
+	}
+	if changed {
+		if err := os.WriteFile(compatCachePath(), must(json.MarshalIndent(cache, "", "  ")), 0644); err != nil {
+			debugf("failed to save the tool versions (ignored): %v\n", err)
+		}
+	}
+	return out
+}
+
+// compatProblem describes why the tool is not compatible, or returns "" when it is.
+func compatProblem(req toolRequirement, found *toolVersion) string {
+	switch {
+	case found.Path == "":
+		return fmt.Sprintf("%v not found in PATH (%v)", req.Name, req.Reason)
+	case found.Version == "":
+		return fmt.Sprintf("can not tell the version of %v from %q", req.Name, strings.Join(req.Command, " "))
+	case compareVersions(parseVersion(found.Version), parseVersion(req.Min)) < 0:
+		return fmt.Sprintf("%v %v is too old, need %v or newer (%v)", req.Name, found.Version, req.Min, req.Reason)
+	}
+	return ""
+}
+
+// ensureCompatibleTools exits at startup when a tool is missing or too old, rather than failing with a cryptic error
+// in the middle of a run.
+func ensureCompatibleTools() {
+	versions := findToolVersions()
+	var problems []string
+	for _, req := range compatMatrix {
+		if problem := compatProblem(req, versions[req.Name]); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+	if len(problems) > 0 {
+		exitCodef(ExitIncompatible, "%v\n\nHint: upgrade the tools, then check with \"git pr version -check-compat\"", strings.Join(problems, "\n"))
+	}
+}
+
+// showVersion prints the version of git-pr, and with -check-compat, the versions of the tools it runs against the
+// minimum ones.
+func showVersion(args []string) {
+	if len(args) > 0 {
+		exitCodef(ExitConfig, "usage: git pr version [-check-compat]")
+	}
+	version := "(unknown)"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		version = info.Main.Version
+	}
+	fmt.Printf("git-pr %v\n", version)
+	if !config.CheckCompat {
+		return
+	}
+
+	versions := findToolVersions()
+	fmt.Printf("\n%-16v %-10v %-10v\n", "TOOL", "FOUND", "MINIMUM")
+	incompatible := false
+	for _, req := range compatMatrix {
+		found := versions[req.Name]
+		problem := compatProblem(req, found)
+		incompatible = incompatible || problem != ""
+		fmt.Printf("%-16v %-10v %-10v %v\n", req.Name, coalesce(found.Version, "-"), req.Min, xif(problem == "", "✅", "❌ "+problem))
+	}
+	if incompatible {
+		exit(ExitIncompatible)
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"git version 2.39.3 (Apple Git-145)", "2.24.0", 1},
+		{"gh version 2.0.0 (2021-08-24)", "2.0.0", 0},
+		{"git-branchless 0.3.12", "0.4.0", -1},
+		{"git version 2.24", "2.24.0", 0},
+		{"git-branchless-opts 0.10.0", "0.4.0", 1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(parseVersion(tt.a), parseVersion(tt.b)); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -21,11 +25,61 @@ var (
 )
 
 var (
-	emojisx = emojis1 // config emojis
+	emojisx = emojis1 // config emojis, empty for plain ASCII
 	config  Config
 )
 
+// emoji sets for git config git-pr.emojis
+var emojiSets = map[string][]string{
+	"zodiac":    emojis0,
+	"animals":   emojis1,
+	"buildings": emojis2,
+	"vehicles":  emojis3,
+	"food":      emojis4,
+	"ascii":     nil,
+}
+
 const gitconfigTags = "git-pr.tags"
+const gitconfigAssume = "git-pr.assume"
+const gitconfigTemplate = "git-pr.template"
+const gitconfigDescribeCommand = "git-pr.describe-command"
+const gitconfigDispatchInput = "git-pr.dispatch-input"
+const gitconfigMapping = "git-pr.mapping"
+const gitconfigOthersPRs = "git-pr.others-prs"
+const gitconfigEmail = "git-pr.email"
+const gitconfigLogin = "git-pr.login"
+const gitconfigResolveLogins = "git-pr.resolve-logins"
+const gitconfigRefFormat = "git-pr.ref-format"
+const gitconfigMilestone = "git-pr.milestone"
+const gitconfigBaseRev = "git-pr.base-rev"
+const gitconfigKeepBranches = "git-pr.keep-branches"
+const gitconfigExternalMerge = "git-pr.external-merge"
+const gitconfigMergeLabel = "git-pr.merge-label"
+const gitconfigMergeComment = "git-pr.merge-comment"
+const gitconfigEmojis = "git-pr.emojis"
+const gitconfigPlainMarkup = "git-pr.plain-markup"
+const gitconfigReflow = "git-pr.reflow"
+const gitconfigEscapeReferences = "git-pr.escape-references"
+const gitconfigBodySections = "git-pr.body-sections"
+const gitconfigBodySection = "git-pr.body-section" // git-pr.body-section.<name>
+const gitconfigSecretScanner = "git-pr.secret-scanner"
+const gitconfigMaxLines = "git-pr.max-lines"
+const gitconfigMaxFiles = "git-pr.max-files"
+const gitconfigTestPlan = "git-pr.test-plan"
+const gitconfigLocale = "git-pr.locale"
+const gitconfigAppID = "git-pr.app-id"
+const gitconfigAppPrivateKey = "git-pr.app-private-key"
+const gitconfigAppInstallationID = "git-pr.app-installation-id"
+const gitconfigTokenCommand = "git-pr.token-command"
+const gitconfigUser = "git-pr.user"
+const gitconfigVerifyLand = "git-pr.verify-land"
+const gitconfigForge = "git-pr.forge"
+const gitconfigTrackingIssue = "git-pr.tracking-issue"
+const gitconfigStaleApprovedDays = "git-pr.stale-approved-days"
+const gitconfigStaleInactiveDays = "git-pr.stale-inactive-days"
+const gitconfigFast = "git-pr.fast"
+const gitconfigPollInterval = "git-pr.poll-interval"
+const gitconfigPropagationTimeout = "git-pr.propagation-timeout"
 const prDelimiterToGenerated = "[//]: # (BEGIN GIT-PR FOOTER)"
 
 var prDelimiterRegexp = regexp.MustCompile(`\[//]:[^\n]+\bGIT-PR\b`)
@@ -34,25 +88,121 @@ type Config struct {
 	Repo       string // git
 	Remote     string // flag
 	MainBranch string // flag
+	BaseRev    string // flag or git config git-pr.base-rev: the commit of the main branch to pin the stacks on
+	RepoDir    string // flag: the checkout to run in, default to the current directory
+
+	PushRemote string // remote to push branches to: Remote, or ForkRemote when pushing to a fork
+	ForkRemote string // flag
+	HeadOwner  string // owner of the fork, empty when pushing to Repo
+	HeadRepo   string // full name of the fork, see headRepo()
 
-	Host  string // git
-	User  string // gh-cli
-	Token string // gh-cli
-	Email string // git config user.email
+	Host   string   // git
+	Forge  string   // git config git-pr.forge: "github", "gitlab", "bitbucket", or "gitea", default from the host
+	User   string   // gh-cli, or git config git-pr.user
+	Token  string   // gh-cli
+	Email  string   // git config user.email
+	Emails []string // git config git-pr.email (multi-valued): other emails of the user, e.g. work and personal
+
+	AppID             string // git config git-pr.app-id: authenticate as this GitHub App instead of the gh token
+	AppPrivateKey     string // git config git-pr.app-private-key: path of the private key (.pem) of the app
+	AppInstallationID string // git config git-pr.app-installation-id: default to the installation on the repository
+	TokenCommand      string // git config git-pr.token-command: prints the token to use, e.g. from a secret manager
+
+	Logins        map[string]string // git config git-pr.login (multi-valued): "<email> <login>" of commit authors
+	ResolveLogins bool              // git config git-pr.resolve-logins: look up the logins of unknown emails, default true
 
 	Tags []string // git config git-pr.<repo>.tags
 
-	IncludeOtherAuthors bool // flag
+	Mapping   string // git config git-pr.mapping: how commits map to PRs, "remote-ref" (default) or "ghstack"
+	RefFormat string // git config git-pr.ref-format: format of new Remote-Refs, "hash" (default) or "stack"
+
+	BodyTemplate     string // git config git-pr.template: path to the template file
+	DescribeCommand  string // git config git-pr.describe-command
+	Milestone        string // git config git-pr.milestone: title, or "@<path>" of a file on the main branch
+	PlainMarkup      bool   // git config git-pr.plain-markup: no HTML/LaTeX in the stack list, default for GHE
+	Reflow           bool   // git config git-pr.reflow: join the lines of the paragraphs of the commit message
+	EscapeReferences bool   // git config git-pr.escape-references: no issue links and mentions from the commit message
+
+	BodySections        []string          // git config git-pr.body-sections: the sections after the PR description, in order
+	BodySectionCommands map[string]string // git config git-pr.body-section.<name>: the commands of the custom sections
+	SecretScanner       string            // git config git-pr.secret-scanner: "builtin", or a command reading the patch from stdin
+
+	DispatchWorkflow string // flag
+	DispatchInput    string // git config git-pr.dispatch-input
+	TrackingIssue    bool   // git config git-pr.tracking-issue: maintain an issue listing the PRs of each stack
+
+	IncludeOtherAuthors bool   // flag
+	OthersPRs           string // git config git-pr.others-prs: "update" (default) or "keep" the title and body of others' PRs
+
+	MaxLines int  // git config git-pr.max-lines: lines changed per commit, 0 for no limit
+	MaxFiles int  // git config git-pr.max-files: files changed per commit, 0 for no limit
+	Strict   bool // flag: block instead of warning when a commit exceeds the limits
+
+	TestPlan string // git config git-pr.test-plan: "warn" or "require" a test plan in each commit, empty for neither
+	Locale   string // git config git-pr.locale: the language of the generated parts of the PR body, empty for English
+
+	Command string   // arg: the subcommand, empty for submitting the stack
+	Args    []string // arg: the remaining positional arguments
 
-	Verbose bool          // flag
-	Timeout time.Duration // flag
+	TransferRename bool // flag
+	StatusStale    bool // flag
+	SyncKeepFresh  bool // flag
+	PRsMarkdown    bool // flag
+
+	StaleApprovedDays int // git config git-pr.stale-approved-days
+	StaleInactiveDays int // git config git-pr.stale-inactive-days
+
+	AssumeYes     bool // flag
+	AssumeNo      bool // flag
+	DefaultAnswer bool // git config git-pr.assume, used when stdin is not a terminal
+
+	ChecksTimeout time.Duration // flag
+	DryRun        bool          // flag
+	Until         string        // flag: submit the stack up to this commit only
+	Stack         string        // flag: run on the stack with this name instead of the current one
+	KeepBranches  bool          // flag or git config git-pr.keep-branches: keep the PR branches after landing
+	ExternalMerge bool          // flag or git config git-pr.external-merge: a merge bot merges the PRs, git-pr triggers it
+	MergeLabel    string        // git config git-pr.merge-label: label which triggers the merge bot, e.g. "ready-to-merge"
+	MergeComment  string        // git config git-pr.merge-comment: comment which triggers the merge bot, e.g. "bors r+"
+	VerifyLand    bool          // git config git-pr.verify-land: verify the squash commit on the main branch after landing
+	CheckCompat   bool          // flag
+	AnnotateNotes bool          // flag
+
+	Fast               bool          // flag or git config git-pr.fast: poll faster, when the pushes show up in the API almost instantly
+	PollInterval       time.Duration // git config git-pr.poll-interval: first interval of waiting for the checks
+	PropagationTimeout time.Duration // git config git-pr.propagation-timeout: how long to wait for the pushes to show up in the API
+
+	APIStats bool          // flag
+	Verbose  bool          // flag
+	Timeout  time.Duration // flag
 }
 
 func LoadConfig() (config Config) {
 	flag.BoolVar(&config.Verbose, "v", false, "Verbose output")
+	flag.BoolVar(&config.APIStats, "api", false, "Print the GitHub API usage at the end (stats: of the previous runs)")
+	flag.StringVar(&config.RepoDir, "repo", "", "Path of the checkout to run in (default to the current directory)")
 	flag.StringVar(&config.Remote, "remote", "origin", "Remote name")
 	flag.StringVar(&config.MainBranch, "main", "main", "Main branch name")
+	flag.StringVar(&config.BaseRev, "base-rev", "", "Pin the stack on this commit of the main branch instead of its latest commit (default from git config git-pr.base-rev)")
+	flag.StringVar(&config.ForkRemote, "fork-remote", "fork", "Remote name for your fork, used when you don't have push access to the repository")
 	flag.BoolVar(&config.IncludeOtherAuthors, "include-other-authors", false, "Create PRs for commits from other authors (default to false: skip)")
+	flag.StringVar(&config.DispatchWorkflow, "dispatch", "", "Workflow (file name or id) to dispatch on the top of the stack after submitting")
+	flag.StringVar(&config.Stack, "stack", "", "Run on the stack with this name (a branch or a Stack: trailer) instead of the current one")
+	flag.StringVar(&config.Until, "until", "", "Submit the stack up to this commit only, keeping the commits above local")
+	flag.BoolVar(&config.Strict, "strict", false, "Do not push when a commit exceeds git-pr.max-lines or git-pr.max-files")
+	flag.BoolVar(&config.AssumeYes, "assume-yes", false, "Answer yes to all prompts")
+	flag.BoolVar(&config.AssumeNo, "assume-no", false, "Answer no to all prompts")
+	flag.BoolVar(&config.StatusStale, "stale", false, "status: Only show the PRs which need attention")
+	flag.BoolVar(&config.PRsMarkdown, "markdown", false, "prs: Print a markdown list instead of the URLs")
+	flag.BoolVar(&config.SyncKeepFresh, "keep-fresh", false, "sync: Rebase all local stacks onto the main branch and push them, for running from cron")
+	flag.BoolVar(&config.DryRun, "dry-run", false, "squash-land: Print the actions and the predicted blockers without changing anything")
+	flag.BoolVar(&config.KeepBranches, "keep-branches", false, "squash-land: Keep the PR branch after merging (default from git config git-pr.keep-branches)")
+	flag.DurationVar(&config.ChecksTimeout, "checks-timeout", 30*time.Minute, "squash-land: How long to wait for the checks to complete")
+	flag.BoolVar(&config.ExternalMerge, "external-merge", false, "squash-land: Trigger the merge bot with git-pr.merge-label or git-pr.merge-comment and wait for it to merge (default from git config git-pr.external-merge)")
+	flag.BoolVar(&config.Fast, "fast", false, "Poll the API faster, for small repositories where the pushes show up almost instantly (default from git config git-pr.fast)")
+	flag.BoolVar(&config.CheckCompat, "check-compat", false, "version: Check the versions of git and git-branchless against the minimum ones")
+	flag.BoolVar(&config.AnnotateNotes, "notes", false, "annotate: Also write the annotations as git notes (refs/notes/git-pr), for git log --notes=git-pr")
+	flag.BoolVar(&config.TransferRename, "rename", false, "transfer: Rename the Remote-Ref branches to the new owner's namespace")
 
 	flagGitHubHosts := flag.String("gh-hosts", "~/.config/gh/hosts.yml", "Path to config.json")
 	flagTimeout := flag.Int("timeout", 20, "API call timeout in seconds")
@@ -60,20 +210,163 @@ func LoadConfig() (config Config) {
 	flagTags := flag.String("t", "", "Set tags for current stack, ignore default (comma separated)")
 
 	// parse flags
-	usage := "Usage: git pr [options]"
+	usage := `Usage: git pr [command] [options]
+
+Commands:
+  (none)             Push the stack and create/update one PR for each commit
+  continue           Resume the last run of "git pr" when it did not complete
+  transfer <user>    Hand the stack over to another user
+  revert <pr>...     Revert landed PRs and submit the reverts as new PRs
+  review <pr>        Step through a stack of PRs as a reviewer
+  amend [commit]     Absorb uncommitted changes into a commit of the stack and submit
+  absorb             Absorb uncommitted changes into the matching commits of the stack and submit
+  status             Show the PRs of the stack
+  prs                Print the PR URLs of the stack, one per line
+  sync               Rebase the stack onto the main branch and submit it
+  sync -keep-fresh   Rebase all local stacks onto the main branch and push them
+  hold [commit]      Mark a commit of the stack as on hold, to never land it
+  unhold [commit]    Remove the hold of a commit
+  workspace new <n>  Create a worktree at the main branch for a new stack
+  workspace list     Show the worktrees with their stacks and PRs
+  adopt-branch <b>   Turn a feature branch into a stack: linearize, split, and submit it
+  squash-land        Submit a one-commit stack, wait for the checks, and squash-merge the PR
+  stats -api         Show the GitHub API usage of the previous runs by command
+  state export       Print the Remote-Refs, PR numbers, and bases of the stack as json
+  state import [f]   Restore the Remote-Refs of the stack from an exported state (default: stdin)
+  annotate [range]   Show the PR and stack which each commit of the main branch came from
+  version            Print the version of git-pr, and of the tools it runs with -check-compat
+
+Options:`
 	flag.Usage = func() {
 		fmt.Println(usage)
 		flag.PrintDefaults()
 	}
-	flag.Parse()
+	args := parseArgs(os.Args[1:])
+	if len(args) > 0 {
+		config.Command, config.Args = args[0], args[1:]
+	}
 
 	// configs from flags
+	if config.RepoDir != "" {
+		dir, err := filepath.Abs(expandPath(config.RepoDir))
+		if err == nil {
+			_, err = os.Stat(dir)
+		}
+		if err != nil {
+			exitCodef(ExitConfig, "invalid -repo %q: %v", config.RepoDir, err)
+		}
+		workDir = dir
+	}
+	config.PushRemote = config.Remote
 	config.Timeout = time.Duration(*flagTimeout) * time.Second
 	if *flagSetTags != "" {
 		tags := saveGitPRConfig(strings.Split(*flagSetTags, ","))
 		fmt.Printf("Set default tags: %v\n", strings.Join(tags, ", "))
 		os.Exit(0)
 	}
+	if config.AssumeYes && config.AssumeNo {
+		exitCodef(ExitConfig, "-assume-yes and -assume-no can not be used together")
+	}
+	if assume, _ := getGitConfig(gitconfigAssume); assume != "" {
+		switch strings.ToLower(assume) {
+		case "yes", "y", "true":
+			config.DefaultAnswer = true
+		case "no", "n", "false":
+			config.DefaultAnswer = false
+		default:
+			exitCodef(ExitConfig, "invalid %v: %q (expect yes or no)", gitconfigAssume, assume)
+		}
+	}
+	config.BodyTemplate = defaultBodyTemplate
+	if templatePath, _ := getGitConfig(gitconfigTemplate); templatePath != "" {
+		data, err := os.ReadFile(repoPath(expandPath(templatePath)))
+		if err != nil {
+			exitCodef(ExitConfig, "failed to read %v: %v", gitconfigTemplate, err)
+		}
+		config.BodyTemplate = string(data)
+	}
+	config.Mapping, _ = getGitConfig(gitconfigMapping)
+	switch config.Mapping {
+	case "":
+		config.Mapping = mappingRemoteRef
+	case mappingRemoteRef, mappingGhstack:
+	default:
+		exitCodef(ExitConfig, "invalid %v: %q (expect %v or %v)", gitconfigMapping, config.Mapping, mappingRemoteRef, mappingGhstack)
+	}
+	config.OthersPRs, _ = getGitConfig(gitconfigOthersPRs)
+	switch config.OthersPRs {
+	case "":
+		config.OthersPRs = othersPRsUpdate
+	case othersPRsUpdate, othersPRsKeep:
+	default:
+		exitCodef(ExitConfig, "invalid %v: %q (expect %v or %v)", gitconfigOthersPRs, config.OthersPRs, othersPRsUpdate, othersPRsKeep)
+	}
+	config.RefFormat, _ = getGitConfig(gitconfigRefFormat)
+	switch config.RefFormat {
+	case "":
+		config.RefFormat = refFormatHash
+	case refFormatHash, refFormatStack:
+	default:
+		exitCodef(ExitConfig, "invalid %v: %q (expect %v or %v)", gitconfigRefFormat, config.RefFormat, refFormatHash, refFormatStack)
+	}
+	if name, _ := getGitConfig(gitconfigEmojis); name != "" {
+		set, ok := emojiSets[name]
+		if !ok {
+			exitCodef(ExitConfig, "invalid %v: %q (expect zodiac, animals, buildings, vehicles, food, or ascii)", gitconfigEmojis, name)
+		}
+		emojisx = set
+	}
+	config.DescribeCommand, _ = getGitConfig(gitconfigDescribeCommand)
+	sections, _ := getGitConfig(gitconfigBodySections)
+	config.BodySectionCommands = map[string]string{}
+	for _, name := range strings.Split(coalesce(sections, defaultBodySections), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || containsString(config.BodySections, name) {
+			continue
+		}
+		if bodySections[name] == nil {
+			command, _ := getGitConfig(gitconfigBodySection + "." + name)
+			if command == "" {
+				exitCodef(ExitConfig, "invalid %v: unknown section %q\n\nHint: set its command with git config %v.%v", gitconfigBodySections, name, gitconfigBodySection, name)
+			}
+			config.BodySectionCommands[name] = command
+		}
+		config.BodySections = append(config.BodySections, name)
+	}
+	config.SecretScanner, _ = getGitConfig(gitconfigSecretScanner)
+	config.Milestone, _ = getGitConfig(gitconfigMilestone)
+	config.DispatchInput = "prs"
+	if out, err := execGit("config", "--get", gitconfigDispatchInput); err == nil {
+		config.DispatchInput = strings.TrimSpace(out) // can be set to empty to not send any input
+	}
+	if config.BaseRev == "" {
+		config.BaseRev, _ = getGitConfig(gitconfigBaseRev)
+	}
+	config.TrackingIssue = getGitConfigBool(gitconfigTrackingIssue)
+	config.KeepBranches = config.KeepBranches || getGitConfigBool(gitconfigKeepBranches)
+	config.ExternalMerge = config.ExternalMerge || getGitConfigBool(gitconfigExternalMerge)
+	config.MergeLabel, _ = getGitConfig(gitconfigMergeLabel)
+	config.MergeComment, _ = getGitConfig(gitconfigMergeComment)
+	config.VerifyLand = getGitConfigBool(gitconfigVerifyLand)
+	config.TestPlan, _ = getGitConfig(gitconfigTestPlan)
+	switch config.TestPlan {
+	case "", testPlanWarn, testPlanRequire:
+	default:
+		exitCodef(ExitConfig, "invalid %v: %q (expect %v or %v)", gitconfigTestPlan, config.TestPlan, testPlanWarn, testPlanRequire)
+	}
+	if locale, _ := getGitConfig(gitconfigLocale); locale != "" {
+		var ok bool
+		if config.Locale, ok = parseLocale(locale); !ok {
+			exitCodef(ExitConfig, "invalid %v: %q (expect one of %v)", gitconfigLocale, locale, strings.Join(availableLocales(), ", "))
+		}
+	}
+	config.MaxLines = getGitConfigInt(gitconfigMaxLines, 0)
+	config.MaxFiles = getGitConfigInt(gitconfigMaxFiles, 0)
+	config.StaleApprovedDays = getGitConfigInt(gitconfigStaleApprovedDays, 3)
+	config.StaleInactiveDays = getGitConfigInt(gitconfigStaleInactiveDays, 7)
+	config.Fast = config.Fast || getGitConfigBool(gitconfigFast)
+	config.PollInterval = getGitConfigDuration(gitconfigPollInterval, xif(config.Fast, time.Second, 5*time.Second))
+	config.PropagationTimeout = getGitConfigDuration(gitconfigPropagationTimeout, xif(config.Fast, 10*time.Second, 30*time.Second))
 	config.Tags = getGitPRConfig()
 	if *flagTags != "" {
 		config.Tags = nil // override default tags
@@ -89,59 +382,132 @@ func LoadConfig() (config Config) {
 	// detect repository
 	out, err := execGit("remote", "show", config.Remote)
 	if err != nil {
-		exitf("not a git repository")
+		exitCodef(ExitConfig, "not a git repository")
 	}
 	regexpURL := regexp.MustCompile(`git@([^:\s]+):([^/\s]+)/([^.\s]+)(\.git)?`)
 	matches := regexpURL.FindStringSubmatch(out)
 	if matches == nil {
 		// match https url
-		regexpURL = regexp.MustCompile(`https://(github\.com)/([^/\s]+)\/([^.\s]+)(\.git)?`)
+		regexpURL = regexp.MustCompile(`https://(?:[^@/\s]+@)?([^/\s]+)/([^/\s]+)\/([^.\s]+)(\.git)?`)
 		matches = regexpURL.FindStringSubmatch(out)
 		if matches == nil {
-			exitf("failed to parse remote url: expect git@<host>:<user>/<repo> or https://github.com/<user>/<repo> (got %q)", out)
+			exitCodef(ExitConfig, "failed to parse remote url: expect git@<host>:<user>/<repo> or https://<host>/<user>/<repo> (got %q)", out)
 		}
 	}
 	config.Host = matches[1]
 	config.Repo = matches[2] + "/" + matches[3]
+	config.Forge, _ = getGitConfig(gitconfigForge)
+	switch config.Forge {
+	case "":
+		config.Forge = detectForge(config.Host, config.Timeout)
+	case forgeGitHub, forgeGitLab, forgeBitbucket, forgeGitea:
+	default:
+		exitCodef(ExitConfig, "invalid %v: %q (expect %v, %v, %v, or %v)", gitconfigForge, config.Forge, forgeGitHub, forgeGitLab, forgeBitbucket, forgeGitea)
+	}
+	config.Reflow = getGitConfigBool(gitconfigReflow)
+	config.EscapeReferences = getGitConfigBool(gitconfigEscapeReferences)
+	if value, _ := getGitConfig(gitconfigPlainMarkup); value != "" {
+		config.PlainMarkup = getGitConfigBool(gitconfigPlainMarkup)
+	} else {
+		config.PlainMarkup = config.Host != "github.com" // GitHub Enterprise renders the LaTeX markup literally
+	}
 
-	// parse github config
-	ghHosts, err := LoadGitHubConfig(*flagGitHubHosts)
-	if err != nil {
-		fmt.Printf("failed to load GitHub config at %v: %v\n", *flagGitHubHosts, err)
-		fmt.Printf(`
-Hint: Install github client and login with your account
-      https://github.com/cli/cli#installation
-Then:
-      gh auth login
-`)
-		os.Exit(1)
+	config.AppID, _ = getGitConfig(gitconfigAppID)
+	config.AppPrivateKey, _ = getGitConfig(gitconfigAppPrivateKey)
+	config.AppInstallationID, _ = getGitConfig(gitconfigAppInstallationID)
+	config.TokenCommand, _ = getGitConfig(gitconfigTokenCommand)
+	if config.AppID != "" && config.AppPrivateKey == "" {
+		exitCodef(ExitConfig, "missing %v for %v", gitconfigAppPrivateKey, gitconfigAppID)
+	}
+	appAuth := config.AppID != "" || config.TokenCommand != ""
+	if config.Forge != forgeGitHub {
+		if config.AppID != "" {
+			exitCodef(ExitConfig, "%v is only supported on GitHub: use %v on %v", gitconfigAppID, gitconfigTokenCommand, forgeDisplayName(config.Forge))
+		}
+		if config.DispatchWorkflow != "" || config.TrackingIssue || config.Milestone != "" {
+			exitCodef(ExitConfig, "-dispatch, %v, and %v are only supported on GitHub", gitconfigTrackingIssue, gitconfigMilestone)
+		}
+		if config.ExternalMerge && config.MergeComment != "" {
+			exitCodef(ExitConfig, "%v is only supported on GitHub: use %v on %v", gitconfigMergeComment, gitconfigMergeLabel, forgeDisplayName(config.Forge))
+		}
+	}
+	if config.ExternalMerge && config.MergeLabel == "" && config.MergeComment == "" {
+		exitCodef(ExitConfig, "missing %v or %v: how to trigger the merge bot with -external-merge", gitconfigMergeLabel, gitconfigMergeComment)
 	}
-	ghHost := ghHosts[config.Host]
-	if ghHost == nil {
-		fmt.Printf("no GitHub config for host %v\n", config.Host)
-		fmt.Print(`
-Hint: Check your ~/.config/gh/hosts.yml
-Run the following command and choose your github host:
 
-      gh auth login
-`)
-		os.Exit(1)
+	// the token is from the environment like gh does, then from the gh config, the keyring, or "gh auth token"; on
+	// the other forges, only from the environment (e.g. GITLAB_TOKEN like glab does)
+	config.Token = tokenFromEnv(config.Host)
+	if config.Forge != forgeGitHub {
+		config.Token = os.Getenv(forgeTokens[config.Forge].Env)
+	} else {
+		ghHosts, err := LoadGitHubConfig(*flagGitHubHosts)
+		if err != nil && config.Token == "" {
+			debugf("failed to load GitHub config at %v (ignored): %v\n", *flagGitHubHosts, err)
+		}
+		if ghHost := ghHosts[config.Host]; ghHost != nil {
+			config.User = ghHost.User
+			config.Token = coalesce(config.Token, ghHost.OauthToken)
+		}
 	}
-	config.User = ghHost.User
-	config.Token = ghHost.OauthToken
 	config.Email = must(getGitConfig("user.email"))
-	if config.Token == "" { // try getting from keyring
+	if out, err := execGit("config", "--get-all", gitconfigEmail); err == nil {
+		for _, email := range strings.FieldsFunc(out, func(r rune) bool { return r == '\n' || r == ',' }) {
+			if email = strings.TrimSpace(email); email != "" {
+				config.Emails = append(config.Emails, email)
+			}
+		}
+	}
+	config.Logins = map[string]string{}
+	if out, err := execGit("config", "--get-all", gitconfigLogin); err == nil {
+		for _, line := range strings.Split(out, "\n") {
+			fields := strings.Fields(line)
+			if len(fields) != 2 {
+				continue
+			}
+			config.Logins[strings.ToLower(fields[0])] = strings.TrimPrefix(fields[1], "@")
+		}
+	}
+	config.ResolveLogins = true
+	if value, _ := getGitConfig(gitconfigResolveLogins); value != "" {
+		config.ResolveLogins = getGitConfigBool(gitconfigResolveLogins)
+	}
+	if user, _ := getGitConfig(gitconfigUser); user != "" {
+		config.User = user
+	}
+	if config.Token == "" && !appAuth && config.Forge != forgeGitHub {
+		token := forgeTokens[config.Forge]
+		exitCodef(ExitAuth, "no %v token found for host %v\n\nHint: set %v to %v, or set %v", forgeDisplayName(config.Forge), config.Host, token.Env, token.Desc, gitconfigTokenCommand)
+	}
+	if config.Token == "" && !appAuth { // try getting from keyring
 		key := "gh:" + config.Host
 		config.Token, _ = keyring.Get(key, "")
 	}
-	if config.Token == "" {
+	if config.Token == "" && !appAuth {
+		out, _ := execCommand("gh", "auth", "token", "--hostname", config.Host)
+		config.Token = strings.TrimSpace(out)
+	}
+	if config.Token == "" && !appAuth {
 		fmt.Printf("no GitHub token found for host %v\n", config.Host)
 		fmt.Print(`
-Hint: use github cli to login to your account:
+Hint: set GH_TOKEN, or use github cli to login to your account:
 
       gh auth login
 `)
-		os.Exit(1)
+		os.Exit(ExitAuth)
+	}
+	if config.User == "" && appAuth {
+		exitCodef(ExitConfig, "missing %v: the user to create the branches and PRs for, with %v", gitconfigUser, xif(config.AppID != "", gitconfigAppID, gitconfigTokenCommand))
+	}
+	if config.User == "" && config.Forge == forgeBitbucket {
+		exitCodef(ExitConfig, "missing %v: the user to create the branches for, as the access tokens of Bitbucket have no user", gitconfigUser)
+	}
+	if config.User == "" { // not in the gh config, e.g. with a token from the environment
+		user, err := forgeTokenUser(config.Forge, config.Host, config.Token, config.Timeout)
+		if err != nil {
+			exitCodef(ExitAuth, "failed to get the %v user of the token: %v", forgeDisplayName(config.Forge), err)
+		}
+		config.User = user
 	}
 
 	validateConfig("user", config.User)
@@ -157,6 +523,20 @@ type GitHubConfigHost struct {
 	GitProtocol string `yaml:"git_protocol"`
 }
 
+// tokenFromEnv returns the token from the environment variables which gh reads for the host, or "" if none is set.
+func tokenFromEnv(host string) string {
+	names := []string{"GH_TOKEN", "GITHUB_TOKEN"}
+	if host != "github.com" {
+		names = []string{"GH_ENTERPRISE_TOKEN", "GITHUB_ENTERPRISE_TOKEN"}
+	}
+	for _, name := range names {
+		if token := os.Getenv(name); token != "" {
+			return token
+		}
+	}
+	return ""
+}
+
 func LoadGitHubConfig(configPath string) (out GitHubConfigHostsFile, _ error) {
 	configPath = expandPath(configPath)
 	data, err := os.ReadFile(configPath)
@@ -179,6 +559,35 @@ func getGitConfig(name string) (string, error) {
 	return strings.TrimSpace(out), nil
 }
 
+func getGitConfigInt(name string, defaultValue int) int {
+	value, _ := getGitConfig(name)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		exitCodef(ExitConfig, "invalid %v: %q (expect a number)", name, value)
+	}
+	return n
+}
+
+func getGitConfigDuration(name string, defaultValue time.Duration) time.Duration {
+	value, _ := getGitConfig(name)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		exitCodef(ExitConfig, "invalid %v: %q (expect a duration, e.g. 2s)", name, value)
+	}
+	return d
+}
+
+func getGitConfigBool(name string) bool {
+	out, err := execGit("config", "--type=bool", "--get", name)
+	return err == nil && strings.TrimSpace(out) == "true"
+}
+
 func expandPath(path string) string {
 	if path == "" {
 		return ""
@@ -192,7 +601,7 @@ func expandPath(path string) string {
 func validateConfig[T comparable](name string, value T) {
 	var zero T
 	if value == zero {
-		exitf("missing config %q", name)
+		exitCodef(ExitConfig, "missing config %q", name)
 	}
 }
 
@@ -221,3 +630,28 @@ func saveGitPRConfig(tags []string) []string {
 	must(execGit("config", "--add", gitconfigTags, rawTags))
 	return xtags
 }
+
+// parseArgs parses flags which may appear before or after the positional arguments and returns the positional ones.
+// Invalid flags exit with ExitUsage, instead of the exit code 2 of the flag package which is for the bugs.
+func parseArgs(args []string) (positional []string) {
+	// the error is printed below, without the whole usage
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	flag.CommandLine.Usage = func() {}
+	flag.CommandLine.SetOutput(io.Discard)
+	for {
+		err := flag.CommandLine.Parse(args)
+		if errors.Is(err, flag.ErrHelp) {
+			flag.CommandLine.SetOutput(nil)
+			flag.Usage()
+			exit(0)
+		}
+		if err != nil {
+			exitCodef(ExitUsage, "%v\n\nHint: run \"git pr -h\" for the usage", err)
+		}
+		args = flag.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional, args = append(positional, args[0]), args[1:]
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// continueSubmit resumes the last "git pr" run when it did not complete, with the same -until and -base-rev. The
+// commits already pushed are not pushed again and the existing PRs are reused, so it picks up from the last step done
+// for each commit.
+func continueSubmit(args []string) {
+	if len(args) > 0 {
+		exitCodef(ExitConfig, "usage: git pr continue")
+	}
+	gitDir := repoPath(strings.TrimSpace(must(execGit("rev-parse", "--git-dir"))))
+	for _, dir := range []string{"rebase-merge", "rebase-apply"} {
+		if _, err := os.Stat(filepath.Join(gitDir, dir)); err == nil {
+			exitCodef(ExitConflict, `a rebase is in progress
+
+Hint: finish it with "git rebase --continue" (or "git rebase --abort"), then run "git pr continue"`)
+		}
+	}
+	if continueReverts() {
+		submitStack()
+		return
+	}
+	run := loadSubmitRun()
+	if run == nil || run.Done {
+		fmt.Println("nothing to continue: the last run completed")
+		return
+	}
+
+	fmt.Printf("continue the run started at %v\n", run.Started.Local().Format("2006-01-02 15:04:05"))
+	originMain := fmt.Sprintf("%v/%v", config.Remote, config.MainBranch)
+	results := loadSubmitResults()
+	for _, commit := range must(getStackedCommits(originMain, head)) {
+		result := results[commit.GetRemoteRef()]
+		if result == nil || result.Time.Before(run.Started) {
+			continue
+		}
+		fmt.Printf("  %v %v — %v\n", commit.ShortHash(), shortenTitle(commit.Title), describeSubmitStep(result))
+	}
+	fmt.Println()
+	config.Until = coalesce(config.Until, run.Until)
+	config.BaseRev = coalesce(config.BaseRev, run.BaseRev)
+	submitStack()
+}
+
+// describeSubmitStep tells how far the commit went in the interrupted run.
+func describeSubmitStep(result *SubmitResult) string {
+	msg, _, _ := strings.Cut(strings.TrimSpace(result.Error), "\n")
+	var done string
+	switch result.Step {
+	case submitStepUpdated:
+		return "done"
+	case submitStepPR:
+		done = fmt.Sprintf("pushed, #%v found", result.PRNumber)
+	case submitStepPushed:
+		done = "pushed"
+	default:
+		done = "not pushed"
+	}
+	if msg != "" {
+		return done + ", failed: " + msg
+	}
+	return done
+}
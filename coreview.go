@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// coReview is a reviewer requested by a "Co-Review:" trailer, with the files of the commit to review.
+type coReview struct {
+	Reviewer string // "@user" or "@org/team"
+	Files    []string
+}
+
+// getCoReviews matches the files changed by the commit against its "Co-Review:" trailers, which map reviewers to path
+// globs with the CODEOWNERS syntax:
+//
+//	Co-Review: @alice schema/**, *.sql
+//	Co-Review: @myorg/frontend web/
+func getCoReviews(commit *Commit) (reviews []coReview) {
+	var rules []codeOwnersRule
+	for _, kv := range commit.Attrs {
+		if kv[0] != KeyCoReview {
+			continue
+		}
+		var reviewers, globs []string
+		for _, field := range strings.Fields(strings.ReplaceAll(kv[1], ",", " ")) {
+			if strings.HasPrefix(field, "@") {
+				reviewers = append(reviewers, field)
+			} else {
+				globs = append(globs, field)
+			}
+		}
+		for _, glob := range globs {
+			rules = append(rules, codeOwnersRule{Pattern: codeOwnersPattern(glob), Owners: reviewers})
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	index := map[string]int{}
+	out := must(execGit("show", "--name-only", "--format=", commit.Hash))
+	for _, path := range strings.Split(out, "\n") {
+		if path == "" {
+			continue
+		}
+		seen := map[string]bool{}
+		for _, rule := range rules { // unlike CODEOWNERS, all matching rules apply
+			if !rule.Pattern.MatchString(path) {
+				continue
+			}
+			for _, reviewer := range rule.Owners {
+				if seen[reviewer] {
+					continue
+				}
+				seen[reviewer] = true
+				i, ok := index[reviewer]
+				if !ok {
+					i = len(reviews)
+					index[reviewer] = i
+					reviews = append(reviews, coReview{Reviewer: reviewer})
+				}
+				reviews[i].Files = append(reviews[i].Files, path)
+			}
+		}
+	}
+	return reviews
+}
+
+// formatCoReviews lists the files to review for each co-reviewer, for the PR body.
+func formatCoReviews(reviews []coReview) string {
+	var b strings.Builder
+	fprintf(&b, "**%v:**\n", localize("Co-review"))
+	for _, review := range reviews {
+		files := make([]string, len(review.Files))
+		for i, file := range review.Files {
+			files[i] = "`" + file + "`"
+		}
+		fprintf(&b, "* %v: %v\n", review.Reviewer, strings.Join(files, ", "))
+	}
+	return b.String()
+}
+
+// requestCoReviews requests reviews from the co-reviewers who have not been requested or reviewed the PR yet.
+func requestCoReviews(pr *PR, reviews []coReview) {
+	skip := map[string]bool{strings.ToLower(pr.User.Login): true}
+	for _, user := range pr.RequestedReviewers {
+		skip[strings.ToLower(user.Login)] = true
+	}
+	for _, team := range pr.RequestedTeams {
+		skip[strings.ToLower(team.Slug)] = true
+	}
+	for _, review := range must(githubListReviews(pr.Number)) {
+		skip[strings.ToLower(review.User.Login)] = true
+	}
+
+	var users, teams []string
+	for _, review := range reviews {
+		name := strings.TrimPrefix(review.Reviewer, "@")
+		if _, team, ok := strings.Cut(name, "/"); ok {
+			if !skip[strings.ToLower(team)] {
+				teams = append(teams, team)
+			}
+		} else if !skip[strings.ToLower(name)] {
+			users = append(users, name)
+		}
+	}
+	if len(users) == 0 && len(teams) == 0 {
+		return
+	}
+	fmt.Printf("request reviews on #%v from %v\n", pr.Number, strings.Join(append(users, teams...), ", "))
+	must(0, githubRequestReviewers(pr.Number, users, teams))
+}
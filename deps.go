@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// "Depends-On: #123, owner/repo#124" or "Depends-On: https://github.com/owner/repo/pull/125"
+var regexpDependsOn = regexp.MustCompile(`(?:https?://[^/\s]+/([\w.-]+/[\w.-]+)/pull/|([\w.-]+/[\w.-]+)?#)([0-9]+)`)
+
+// Dependency is a PR from a "Depends-On:" trailer, in this repository or another one.
+type Dependency struct {
+	Repo   string // owner/repo
+	Number int
+}
+
+// getDependsOn returns the PRs from the "Depends-On:" trailers of the commit, for PRs outside of the stack which must
+// be merged first.
+func getDependsOn(commit *Commit) (deps []Dependency) {
+	for _, kv := range commit.Attrs {
+		if kv[0] != KeyDependsOn {
+			continue
+		}
+		for _, m := range regexpDependsOn.FindAllStringSubmatch(kv[1], -1) {
+			number, _ := strconv.Atoi(m[3])
+			deps = append(deps, Dependency{Repo: coalesce(coalesce(m[1], m[2]), config.Repo), Number: number})
+		}
+	}
+	return deps
+}
+
+// loadDependencies gets the PRs which the commit depends on, from their repositories.
+func loadDependencies(commit *Commit) (prs []*PR) {
+	for _, dep := range getDependsOn(commit) {
+		prs = append(prs, must(githubGetPRInRepo(dep.Repo, dep.Number)))
+	}
+	return prs
+}
+
+// formatDependencies describes the dependencies which are not merged yet, e.g. "#123 (open), owner/repo#124 (closed)".
+func formatDependencies(prs []*PR) string {
+	var parts []string
+	for _, pr := range prs {
+		if pr.MergedAt == nil {
+			ref := fmt.Sprintf("#%v", pr.Number)
+			if repo := pr.Base.Repo.FullName; repo != "" && !strings.EqualFold(repo, config.Repo) {
+				ref = repo + ref
+			}
+			parts = append(parts, fmt.Sprintf("%v (%v)", ref, pr.State))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// checkDependencies refuses to land the commit when its dependencies are not merged yet.
+func checkDependencies(commit *Commit) {
+	if unmerged := formatDependencies(loadDependencies(commit)); unmerged != "" {
+		exitf("%v depends on unmerged pull requests: %v", commit.ShortHash(), unmerged)
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetDependsOn(t *testing.T) {
+	config.Repo = "acme/app"
+	defer func() { config.Repo = "" }()
+	commit := &Commit{Attrs: []KeyVal{
+		{KeyDependsOn, "#123, acme/lib#7"},
+		{KeyDependsOn, "https://github.com/acme/api/pull/45"},
+	}}
+	want := []Dependency{{"acme/app", 123}, {"acme/lib", 7}, {"acme/api", 45}}
+	if got := getDependsOn(commit); !reflect.DeepEqual(got, want) {
+		t.Errorf("getDependsOn() = %v, want %v", got, want)
+	}
+}
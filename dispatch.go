@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// dispatchStackWorkflow triggers the workflow on the branch at the top of the stack, for the integration suites which
+// should run once per stack rather than once per PR. The PRs of the stack, from the bottom, are passed as the
+// configured input, e.g. "#12,#13,#14".
+func dispatchStackWorkflow(stackedCommits []*Commit) {
+	var top *Commit
+	var prs []string
+	for _, commit := range stackedCommits {
+		if commit.Skip {
+			continue
+		}
+		top = commit
+		prs = append(prs, fmt.Sprintf("#%v", commit.PRNumber))
+	}
+	if top == nil {
+		return
+	}
+	if config.HeadOwner != "" {
+		fmt.Printf("skip dispatching %v: the branches are in your fork\n", config.DispatchWorkflow)
+		return
+	}
+	var inputs map[string]string
+	if config.DispatchInput != "" {
+		inputs = map[string]string{config.DispatchInput: strings.Join(prs, ",")}
+	}
+	fmt.Printf("dispatch workflow %v on %v\n", config.DispatchWorkflow, top.GetRemoteRef())
+	must(0, githubDispatchWorkflow(config.DispatchWorkflow, top.GetRemoteRef(), inputs))
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// ExecError is the failure of a git or git-branchless command, with its output.
+type ExecError struct {
+	Name   string
+	Args   []string
+	Output string
+	Err    error
+}
+
+func (e *ExecError) Error() string {
+	return fmt.Sprintf("%v: %v", e.CommandLine(), e.Err)
+}
+
+// CommandLine returns the command with the long arguments (e.g. commit messages) shortened.
+func (e *ExecError) CommandLine() string {
+	parts := []string{e.Name}
+	for _, arg := range e.Args {
+		if line, _, _ := strings.Cut(arg, "\n"); len(line) > 40 || line != arg {
+			arg = shortenTitle(line)
+		}
+		parts = append(parts, arg)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (e *ExecError) Unwrap() error { return e.Err }
+
+// HTTPError is a GitHub API response with a non-2xx status.
+type HTTPError struct {
+	Method     string
+	URL        string
+	Status     string
+	StatusCode int
+	Body       []byte
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("failed to call http request: (%v) %s", e.Status, e.Body)
+}
+
+// Message returns the message of the GitHub error response, with the details of the validation errors.
+func (e *HTTPError) Message() string {
+	var body struct {
+		Message string `json:"message"`
+		Errors  []struct {
+			Message string `json:"message"`
+			Code    string `json:"code"`
+			Field   string `json:"field"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal(e.Body, &body) != nil || body.Message == "" {
+		return e.Status
+	}
+	msg := body.Message
+	for _, detail := range body.Errors {
+		msg += "; " + coalesce(detail.Message, strings.TrimSpace(detail.Field+" "+detail.Code))
+	}
+	return msg
+}
+
+// handleErrors is deferred at the top of main: it turns the errors from must() into a message with a hint and an exit
+// code. Other panics are bugs, and crash with the stack trace.
+func handleErrors() {
+	if r := recover(); r != nil {
+		exitWithError(r)
+	}
+}
+
+// goroutineErrors passes the first error of the goroutines to main, which exits with it: exiting from a goroutine
+// would skip the deferred calls of main.
+var goroutineErrors = make(chan error, 1)
+
+// forwardErrors is deferred at the top of the goroutines, in place of handleErrors.
+func forwardErrors() {
+	if r := recover(); r != nil {
+		if isBug(r) {
+			panic(r)
+		}
+		select {
+		case goroutineErrors <- r.(error):
+		default: // another goroutine failed first
+		}
+	}
+}
+
+// waitGoroutines waits for the goroutines, then raises the first error of them in the caller.
+func waitGoroutines(wg *sync.WaitGroup) {
+	wg.Wait()
+	select {
+	case err := <-goroutineErrors:
+		panic(err)
+	default:
+	}
+}
+
+// isBug tells whether the panic is a bug rather than an error from must().
+func isBug(r any) bool {
+	err, ok := r.(error)
+	var runtimeErr runtime.Error
+	return !ok || errors.As(err, &runtimeErr)
+}
+
+func exitWithError(r any) {
+	if isBug(r) {
+		panic(r)
+	}
+	err := r.(error)
+	code, msg, hint := ExitError, err.Error(), ""
+	var execErr *ExecError
+	var httpErr *HTTPError
+	switch {
+	case errors.As(err, &httpErr):
+		code, msg, hint = describeHTTPError(httpErr)
+	case errors.As(err, &execErr):
+		code, msg, hint = describeExecError(execErr)
+	}
+	if hint == "" && config.Command == "" {
+		hint = `fix the error, then run "git pr continue" to resume the submit`
+	}
+	fmt.Printf("\nerror: %v\n", msg)
+	if hint != "" {
+		fmt.Printf("\nHint: %v\n", hint)
+	}
+	exit(code)
+}
+
+func describeHTTPError(err *HTTPError) (code int, msg, hint string) {
+	path := err.URL
+	if u, parseErr := url.Parse(err.URL); parseErr == nil {
+		path = u.Path
+	}
+	code, msg = ExitAPI, fmt.Sprintf("%v API %v %v: %v", forgeDisplayName(config.Forge), err.Method, path, err.Message())
+	switch {
+	case err.StatusCode == 403 && strings.Contains(strings.ToLower(err.Message()), "rate limit"):
+		hint = `the API rate limit is exhausted: wait for it to reset (see "git pr stats -api")`
+	case err.StatusCode == 403:
+		hint = fmt.Sprintf(`check that your token can write to %v with "gh auth status", and refresh its scopes with "gh auth refresh -s repo,workflow"`, config.Repo)
+	case err.StatusCode == 404:
+		hint = fmt.Sprintf(`check that %v exists and that your token can access it with "gh auth status"`, config.Repo)
+	case err.StatusCode >= 500:
+		hint = `GitHub may be having issues (https://www.githubstatus.com): try again later with "git pr continue"`
+	}
+	return code, msg, hint
+}
+
+func describeExecError(err *ExecError) (code int, msg, hint string) {
+	output := strings.TrimSpace(err.Output)
+	lastLine := output
+	if i := strings.LastIndex(output, "\n"); i >= 0 {
+		lastLine = output[i+1:]
+	}
+	code, msg = ExitCommand, fmt.Sprintf("%v failed: %v", err.CommandLine(), coalesce(lastLine, err.Err.Error()))
+	switch {
+	case errors.Is(err.Err, exec.ErrNotFound):
+		hint = fmt.Sprintf(`%v is not installed: see "git pr version -check-compat"`, err.Name)
+	case strings.Contains(output, "Permission denied") || strings.Contains(output, "Authentication failed") ||
+		strings.Contains(output, "could not read Username"):
+		code, hint = ExitAuth, `check your access to the remote, e.g. with "gh auth setup-git" or your SSH keys`
+	case strings.Contains(output, "CONFLICT"):
+		code, hint = ExitConflict, "resolve the conflicts, then run the command again"
+	case len(err.Args) > 0 && err.Args[0] == "reword":
+		hint = `"git reword" comes with git-branchless: run "git branchless init" in this repository`
+	}
+	return code, msg, hint
+}
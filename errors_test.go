@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestHTTPErrorMessage(t *testing.T) {
+	err := &HTTPError{Status: "422 Unprocessable Entity", Body: []byte(`{"message":"Validation Failed","errors":[{"resource":"PullRequest","code":"custom","message":"A pull request already exists for foo:bar."}]}`)}
+	if got, want := err.Message(), "Validation Failed; A pull request already exists for foo:bar."; got != want {
+		t.Errorf("Message() = %q, want %q", got, want)
+	}
+	err = &HTTPError{Status: "502 Bad Gateway", Body: []byte("<html>")}
+	if got, want := err.Message(), "502 Bad Gateway"; got != want {
+		t.Errorf("Message() = %q, want %q", got, want)
+	}
+}
+
+func TestExecErrorCommandLine(t *testing.T) {
+	err := &ExecError{Name: "git", Args: []string{"reword", "1a2b3c4d", "-m", "Add the foo API\n\nRemote-Ref: oliver/1a2b3c4d"}, Err: errors.New("exit status 1")}
+	if got, want := err.CommandLine(), "git reword 1a2b3c4d -m Add the foo API"; got != want {
+		t.Errorf("CommandLine() = %q, want %q", got, want)
+	}
+}
+
+func TestWaitGoroutines(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer forwardErrors()
+			if i > 0 {
+				panic(errorf("failed %v", i))
+			}
+		}()
+	}
+	defer func() {
+		if err, _ := recover().(error); err == nil {
+			t.Errorf("waitGoroutines() did not raise the error of the goroutines")
+		}
+		select {
+		case err := <-goroutineErrors:
+			t.Errorf("unexpected error left: %v", err)
+		default:
+		}
+	}()
+	waitGoroutines(&wg)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	forgeGitHub    = "github"
+	forgeGitLab    = "gitlab"
+	forgeBitbucket = "bitbucket"
+	forgeGitea     = "gitea" // and Forgejo
+)
+
+// forgeTokens are the environment variables of the tokens of the forges other than GitHub, and what the token is.
+var forgeTokens = map[string]struct{ Env, Desc string }{
+	forgeGitLab:    {"GITLAB_TOKEN", "a personal access token with the api scope"},
+	forgeBitbucket: {"BITBUCKET_TOKEN", "an access token of the repository with the pull requests write scope"},
+	forgeGitea:     {"GITEA_TOKEN", "an access token with the write:repository scope"},
+}
+
+func forgeDisplayName(name string) string {
+	switch name {
+	case forgeGitLab:
+		return "GitLab"
+	case forgeBitbucket:
+		return "Bitbucket"
+	case forgeGitea:
+		return "Gitea"
+	default:
+		return "GitHub"
+	}
+}
+
+// Forge is the hosting service which the stacks are submitted to, with git config git-pr.forge. These are the
+// operations of submitting and landing a stack: on GitLab, Bitbucket and Gitea, each commit becomes a merge request or
+// a pull request targeting the branch of the previous one. The other features (reviews, labels, milestones, workflows,
+// status...) call the GitHub API directly and are only available on GitHub. Tests can replace the forge with a fake
+// one.
+type Forge interface {
+	// PRURL returns the web URL of the PR.
+	PRURL(number int) string
+	CommitURL(hash string) string
+	// PRRef returns the reference to the PR in markdown and commit messages: "#123" on GitHub, "!123" on GitLab.
+	PRRef(number int) string
+	// GetPRNumber returns the PR of the commit, creating it when its branch has none.
+	GetPRNumber(commit, prev *Commit) (int, error)
+	// GetPRNumberByHead returns the open PR of the branch, or 0 if none.
+	GetPRNumberByHead(branch string) (int, error)
+	GetPR(number int) (*PR, error)
+	// CreatePR creates the PR of the commit on top of the PR of the previous commit, and sets commit.PRNumber.
+	CreatePR(commit, prev *Commit) error
+	// UpdateBase makes the PR of the commit target the branch of the previous commit, or the main branch.
+	UpdateBase(commit, prev *Commit) error
+	UpdatePR(number int, title, body string) error
+	AddLabels(number int, labels ...string) error
+	// ListChecks returns the checks of the commit or branch, as GitHub check runs.
+	ListChecks(ref string) ([]CheckRun, error)
+	// MergePR merges the PR with the method ("merge" or "squash") if its head is still the sha, and returns the new
+	// commit on the main branch. An empty message keeps the default message of the forge.
+	MergePR(number int, method, sha, message string) (mergedSHA string, _ error)
+	// DeleteBranch deletes the branch of a PR, after landing it.
+	DeleteBranch(branch string) error
+	// SearchPR returns the open PR with the title, or 0 if none: for the commits which the forge doesn't know, e.g.
+	// after their branch was force-pushed by someone else.
+	SearchPR(title string) (int, error)
+}
+
+// forge is set in main from git config git-pr.forge.
+var forge Forge = githubForge{}
+
+// detectForge returns the forge of the host when git config git-pr.forge is not set. Self-hosted Gitea and Forgejo
+// instances have any host name: they are recognized by their version endpoint, which GitHub Enterprise doesn't have.
+func detectForge(host string, timeout time.Duration) string {
+	switch {
+	case host == "github.com":
+		return forgeGitHub
+	case host == "gitlab.com" || strings.HasPrefix(host, "gitlab."):
+		return forgeGitLab
+	case host == "bitbucket.org":
+		return forgeBitbucket
+	case host == "codeberg.org" || strings.HasPrefix(host, "gitea.") || strings.HasPrefix(host, "forgejo."):
+		return forgeGitea
+	}
+	var version struct {
+		Version string `json:"version"`
+	}
+	err := getForgeJSON(fmt.Sprintf("https://%v/api/v1/version", host), "", timeout, &version)
+	detected := xif(err == nil && version.Version != "", forgeGitea, forgeGitHub)
+	// the answer of the host is saved in git config git-pr.forge, to not probe it on every run; but not a network error
+	var httpErr *HTTPError
+	if err == nil || errors.As(err, &httpErr) {
+		debugf("detected %v on %v (saved in %v)\n", forgeDisplayName(detected), host, gitconfigForge)
+		_, _ = execGit("config", gitconfigForge, detected)
+	}
+	return detected
+}
+
+// githubOnlyCommands are the commands which are only available on GitHub.
+var githubOnlyCommands = []string{"transfer", "revert", "review", "status", "prs", "sync", "workspace", "adopt-branch", "state"}
+
+type githubForge struct{}
+
+func (githubForge) PRURL(number int) string {
+	return fmt.Sprintf("https://%v/%v/pull/%v", config.Host, config.Repo, number)
+}
+
+func (githubForge) CommitURL(hash string) string {
+	return fmt.Sprintf("https://%v/%v/commit/%v", config.Host, config.Repo, hash)
+}
+
+func (githubForge) PRRef(number int) string {
+	return fmt.Sprintf("#%v", number)
+}
+
+func (githubForge) GetPRNumber(commit, prev *Commit) (int, error) {
+	return githubGetPRNumberForCommit(commit, prev)
+}
+
+func (githubForge) GetPRNumberByHead(branch string) (int, error) {
+	return githubGetPRNumberByHead(branch)
+}
+
+func (githubForge) GetPR(number int) (*PR, error) {
+	return githubGetPRByNumber(number)
+}
+
+func (githubForge) CreatePR(commit, prev *Commit) error {
+	return githubCreatePRForCommit(commit, prev)
+}
+
+func (githubForge) UpdateBase(commit, prev *Commit) error {
+	return githubPRUpdateBaseForCommit(commit, prev)
+}
+
+func (githubForge) UpdatePR(number int, title, body string) error {
+	pullURL := fmt.Sprintf("https://api.%v/repos/%v/pulls/%v", config.Host, config.Repo, number)
+	_, err := httpRequest("PATCH", pullURL, map[string]any{"title": title, "body": body})
+	return err
+}
+
+func (githubForge) AddLabels(number int, labels ...string) error {
+	return githubAddLabels(number, labels...)
+}
+
+func (githubForge) ListChecks(ref string) ([]CheckRun, error) {
+	return githubListCheckRuns(ref)
+}
+
+func (githubForge) MergePR(number int, method, sha, message string) (string, error) {
+	return githubMergePR(number, method, sha, message)
+}
+
+func (githubForge) DeleteBranch(branch string) error {
+	return githubDeleteBranch(branch)
+}
+
+func (githubForge) SearchPR(title string) (int, error) {
+	return githubSearchPRNumberByTitle(title)
+}
+
+// forgeTokenUser returns the user of the token on GitHub, GitLab, or Gitea, while loading the config.
+func forgeTokenUser(forge, host, token string, timeout time.Duration) (string, error) {
+	var out struct {
+		Username string `json:"username"` // GitLab
+		Login    string `json:"login"`    // GitHub and Gitea
+	}
+	userURL := fmt.Sprintf("https://api.%v/user", host)
+	switch forge {
+	case forgeGitLab:
+		userURL = fmt.Sprintf("https://%v/api/v4/user", host)
+	case forgeGitea:
+		userURL = fmt.Sprintf("https://%v/api/v1/user", host)
+	}
+	err := getForgeJSON(userURL, token, timeout, &out)
+	return coalesce(out.Username, out.Login), err
+}
+
+// getForgeJSON calls the API while loading the config, before httpRequest can be used. The token is optional.
+func getForgeJSON(url, token string, timeout time.Duration, out any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	debugf("-> GET %v\n", url)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &HTTPError{Method: "GET", URL: url, Status: resp.Status, StatusCode: resp.StatusCode, Body: data}
+	}
+	if err = json.Unmarshal(data, out); err != nil {
+		return errorf("failed to parse request body: %v", err)
+	}
+	return nil
+}
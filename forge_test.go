@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// fakeForge overrides the methods used by a test, and panics on the others.
+type fakeForge struct {
+	Forge
+	prURL func(number int) string
+}
+
+func (f fakeForge) PRURL(number int) string { return f.prURL(number) }
+
+func TestFormatAnnotationNote(t *testing.T) {
+	defer func(f Forge) { forge = f }(forge)
+	forge = fakeForge{prURL: func(number int) string { return fmt.Sprintf("https://forge.test/pr/%v", number) }}
+
+	got := formatAnnotationNote(&annotation{PRNumber: 42, Stack: "feat"})
+	want := "Pull-Request: https://forge.test/pr/42\nStack: feat"
+	if got != want {
+		t.Errorf("formatAnnotationNote() = %q, want %q", got, want)
+	}
+}
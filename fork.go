@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// setupPushRemote checks whether the user can push to the repository. If not, it offers to push the branches to the
+// user's fork instead and open the PRs with cross-repo heads.
+//
+// GitHub requires the base of a PR to be a branch of the upstream repository, so PRs from a fork can not stack on top
+// of each other: they all target the main branch, and the order is kept in the stack list of each PR.
+func setupPushRemote() {
+	repo := must(githubGetRepo(config.Repo))
+	if repo.Permissions.Push {
+		return
+	}
+	fmt.Printf("you don't have push access to %v\n", config.Repo)
+	if !promptYesNo("Push to your fork instead?") {
+		exitf("can not push to %v", config.Repo)
+	}
+
+	fork := must(githubCreateFork())
+	ready, _ := pollUntil(time.Minute, newBackoff(time.Second, 10*time.Second), func() (bool, error) {
+		_, found, err := httpGETOptional(fmt.Sprintf("https://api.%v/repos/%v", config.Host, fork.FullName))
+		if found {
+			return true, nil
+		}
+		fmt.Printf("waiting for fork %v...\n", fork.FullName) // forking happens asynchronously
+		return false, err
+	})
+	if !ready {
+		exitf("fork %v is not ready, try again later", fork.FullName)
+	}
+
+	if _, err := execGit("remote", "get-url", config.ForkRemote); err != nil {
+		remoteURL := must(execGit("remote", "get-url", config.Remote))
+		forkURL := xif(strings.HasPrefix(remoteURL, "https://"), fork.CloneURL, fork.SSHURL)
+		fmt.Printf("add remote %v %v\n", config.ForkRemote, forkURL)
+		must(execGit("remote", "add", config.ForkRemote, forkURL))
+	}
+	config.PushRemote = config.ForkRemote
+	config.HeadOwner, config.HeadRepo = fork.Owner.Login, fork.FullName
+}
+
+// "git@github.com:owner/repo.git" or "https://github.com/owner/repo"
+var regexpRemoteRepo = regexp.MustCompile(`[:/]([^/:\s]+)/([^/\s]+?)(?:\.git)?/?$`)
+
+// headOwner returns the owner of the stack branches: the fork when pushing to a fork, or the repository owner.
+func headOwner() string {
+	owner, _, _ := strings.Cut(config.Repo, "/")
+	return coalesce(config.HeadOwner, owner)
+}
+
+// headRepo returns the repository which the branches are pushed to: the fork when pushing to a fork, whose name may
+// differ from the upstream one, or Repo. The name of the fork is read from the fork remote.
+func headRepo() string {
+	if config.HeadOwner == "" {
+		return config.Repo
+	}
+	if config.HeadRepo == "" {
+		_, name, _ := strings.Cut(config.Repo, "/")
+		config.HeadRepo = config.HeadOwner + "/" + name
+		if out, err := execGit("remote", "get-url", config.ForkRemote); err == nil {
+			if m := regexpRemoteRepo.FindStringSubmatch(strings.TrimSpace(out)); m != nil {
+				config.HeadRepo = m[1] + "/" + m[2]
+			}
+		}
+	}
+	return config.HeadRepo
+}
+
+// prHead returns the head of the PR for the commit, prefixed with the owner of the fork when pushing to a fork.
+func prHead(commit *Commit) string {
+	if config.HeadOwner != "" {
+		return config.HeadOwner + ":" + commit.GetRemoteRef()
+	}
+	return commit.GetRemoteRef()
+}
+
+// prBase returns the base branch for the PR on top of the previous commit.
+func prBase(prev *Commit) string {
+	if prev == nil || config.HeadOwner != "" {
+		return config.MainBranch
+	}
+	return prev.GetRemoteRef()
+}
@@ -2,7 +2,11 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -151,3 +155,138 @@ func deleteBranch(branch string) error {
 	}
 	return err
 }
+
+// gitPRDir returns the directory for storing git-pr state of the current repository, usually ".git/git-pr".
+func gitPRDir() string {
+	gitDir := strings.TrimSpace(must(execGit("rev-parse", "--git-common-dir")))
+	dir := filepath.Join(repoPath(gitDir), "git-pr")
+	must(0, os.MkdirAll(dir, 0755))
+	return dir
+}
+
+// getRemoteHashes returns the commit hashes of the given branches on the remote, keyed by branch name. Branches which
+// do not exist on the remote are omitted.
+func getRemoteHashes(remote string, branches []string) (map[string]string, error) {
+	out := map[string]string{}
+	if len(branches) == 0 {
+		return out, nil
+	}
+	args := append([]string{"ls-remote", "--heads", remote}, branches...)
+	result, err := execGitRemote(remote, args...)
+	if err != nil {
+		return nil, wrapf(err, "failed to list remote branches")
+	}
+	for _, line := range strings.Split(result, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		out[strings.TrimPrefix(fields[1], "refs/heads/")] = fields[0]
+	}
+	return out, nil
+}
+
+// getLandedCommits returns the hashes of the commits between upstream and head whose patch (by "git patch-id") is
+// already on upstream, e.g. landed from another machine.
+func getLandedCommits(upstream, head string) (map[string]bool, error) {
+	out, err := execGit("cherry", upstream, head)
+	if err != nil {
+		return nil, wrapf(err, "failed to compare commits with %v", upstream)
+	}
+	landed := map[string]bool{}
+	for _, line := range strings.Split(out, "\n") {
+		if hash, ok := strings.CutPrefix(line, "- "); ok {
+			landed[strings.TrimSpace(hash)] = true
+		}
+	}
+	return landed, nil
+}
+
+// isSameChange reports whether the two commits make the same change on the same content, i.e. they only differ by
+// their message or metadata. It's false when either commit is not available locally.
+func isSameChange(a, b string) bool {
+	out, err := execGit("rev-parse", a+"^{tree}", b+"^{tree}", a+"^^{tree}", b+"^^{tree}")
+	if err != nil {
+		return false
+	}
+	trees := strings.Fields(out)
+	return len(trees) == 4 && trees[0] == trees[1] && trees[2] == trees[3]
+}
+
+// CommitStats summarizes the changes of a commit.
+type CommitStats struct {
+	Files      int
+	Insertions int
+	Deletions  int
+	Dirs       []string // top-level directories touched by the commit, "." for files at the root
+
+	Submodules []SubmoduleChange
+}
+
+// SubmoduleChange is a change of the commit recorded for a submodule (gitlink). Old is empty for a new submodule, New
+// for a removed one.
+type SubmoduleChange struct {
+	Path, Old, New string
+}
+
+func (s CommitStats) String() string {
+	return fmt.Sprintf("%v files changed (+%v -%v) in %v", s.Files, s.Insertions, s.Deletions, strings.Join(s.Dirs, ", "))
+}
+
+// OnlySubmodules reports whether the commit only changes submodules.
+func (s CommitStats) OnlySubmodules() bool {
+	return len(s.Submodules) > 0 && len(s.Submodules) == s.Files
+}
+
+func getCommitStats(hash string) (stats CommitStats, _ error) {
+	out, err := execGit("show", "--raw", "--numstat", "--no-abbrev", "--format=", hash)
+	if err != nil {
+		return stats, wrapf(err, "failed to get stats of commit %v", hash)
+	}
+	return parseCommitStats(out), nil
+}
+
+// parseCommitStats parses the output of "git show --raw --numstat": the raw lines (":<mode> <mode> <hash> <hash>
+// <status>\t<path>") give the submodules, the numstat lines the changed lines.
+func parseCommitStats(out string) (stats CommitStats) {
+	const gitlinkMode = "160000"
+	seenDirs := map[string]bool{}
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, ":") {
+			meta, path, _ := strings.Cut(line, "\t")
+			fields := strings.Fields(meta)
+			if len(fields) < 4 || fields[0] != ":"+gitlinkMode && fields[1] != gitlinkMode {
+				continue
+			}
+			change := SubmoduleChange{Path: path}
+			if fields[0] == ":"+gitlinkMode {
+				change.Old = fields[2]
+			}
+			if fields[1] == gitlinkMode {
+				change.New = fields[3]
+			}
+			stats.Submodules = append(stats.Submodules, change)
+			continue
+		}
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		stats.Files++
+		ins, _ := strconv.Atoi(fields[0]) // "-" for binary files
+		del, _ := strconv.Atoi(fields[1])
+		stats.Insertions += ins
+		stats.Deletions += del
+
+		dir := "."
+		if idx := strings.IndexByte(fields[2], '/'); idx >= 0 {
+			dir = strings.TrimPrefix(fields[2][:idx], "{")
+		}
+		if !seenDirs[dir] {
+			seenDirs[dir] = true
+			stats.Dirs = append(stats.Dirs, dir)
+		}
+	}
+	sort.Strings(stats.Dirs)
+	return stats
+}
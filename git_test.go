@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseCommitStats(t *testing.T) {
+	out := ":100644 100644 587be6b4c3f93f93c489c0111bba5596147a26cb b77b4eb1d946f923f61785536da9ca5af6909f06 M\tf\n" +
+		":160000 160000 caab41729b8c121b4180af739753052d397592f2 6837a938dbf02d1a1edbbffd6133ec48c2abff83 M\tlib/sub\n" +
+		"1\t0\tf\n" +
+		"1\t1\tlib/sub\n"
+	stats := parseCommitStats(out)
+	if got := stats.String(); got != "2 files changed (+2 -1) in ., lib" {
+		t.Errorf("String() = %v", got)
+	}
+	want := "[{lib/sub caab41729b8c121b4180af739753052d397592f2 6837a938dbf02d1a1edbbffd6133ec48c2abff83}]"
+	if got := fmt.Sprint(stats.Submodules); got != want {
+		t.Errorf("Submodules = %v", got)
+	}
+	if stats.OnlySubmodules() {
+		t.Errorf("OnlySubmodules() = true")
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Gitea (and Forgejo) makes a PR a work in progress with a prefix in its title
+var regexpGiteaWIPPrefix = regexp.MustCompile(`(?i)^(wip:|\[wip])\s*`)
+
+// giteaTitle returns the title of the PR for the commit title, with the "WIP:" prefix for a draft.
+func giteaTitle(title string) string {
+	if regexpDraft.MatchString(title) && !regexpGiteaWIPPrefix.MatchString(title) {
+		return "WIP: " + title
+	}
+	return title
+}
+
+// GiteaStatus is a commit status of Gitea, reported by Gitea Actions or another CI.
+type GiteaStatus struct {
+	Context   string     `json:"context"`
+	State     string     `json:"status"` // pending, success, error, failure, warning
+	CreatedAt *time.Time `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// toCheckRun converts the status to a GitHub check run, for waiting on the checks and summarizing them.
+func (s *GiteaStatus) toCheckRun() CheckRun {
+	run := CheckRun{Name: s.Context, Status: "completed", StartedAt: s.CreatedAt, CompletedAt: s.UpdatedAt}
+	switch s.State {
+	case "pending":
+		run.Status, run.CompletedAt = "in_progress", nil
+	case "success":
+		run.Conclusion = "success"
+	case "warning":
+		run.Conclusion = "neutral"
+	default:
+		run.Conclusion = "failure"
+	}
+	return run
+}
+
+// giteaForge talks to Gitea and Forgejo, whose PR API is close to GitHub's: the PRs decode as GitHub PRs.
+type giteaForge struct{}
+
+func giteaRepoURL() string {
+	return fmt.Sprintf("https://%v/api/v1/repos/%v", config.Host, config.Repo)
+}
+
+func (giteaForge) PRURL(number int) string {
+	return fmt.Sprintf("https://%v/%v/pulls/%v", config.Host, config.Repo, number)
+}
+
+func (giteaForge) CommitURL(hash string) string {
+	return fmt.Sprintf("https://%v/%v/commit/%v", config.Host, config.Repo, hash)
+}
+
+func (giteaForge) PRRef(number int) string {
+	return fmt.Sprintf("#%v", number)
+}
+
+func (f giteaForge) GetPRNumber(commit, prev *Commit) (int, error) {
+	if commit.PRNumber != 0 {
+		return commit.PRNumber, nil
+	}
+	number, err := f.GetPRNumberByHead(commit.GetRemoteRef())
+	if err != nil || number != 0 || commit.Skip {
+		return number, err
+	}
+	// the commit was pushed and got "Everything up-to-date", try creating new pr
+	if err = f.CreatePR(commit, prev); err != nil {
+		return 0, err
+	}
+	return commit.PRNumber, nil
+}
+
+// GetPRNumberByHead lists the open PRs, as the API can not filter them by head branch.
+func (giteaForge) GetPRNumberByHead(branch string) (int, error) {
+	if branch == "" {
+		return 0, nil
+	}
+	for page := 1; ; page++ {
+		jsonBody, err := httpGET(fmt.Sprintf("%v/pulls?state=open&limit=50&page=%v", giteaRepoURL(), page))
+		if err != nil {
+			return 0, err
+		}
+		var out []PR
+		if err = json.Unmarshal(jsonBody, &out); err != nil {
+			return 0, errorf("failed to parse request body: %v", err)
+		}
+		for _, pr := range out {
+			if pr.Head.Ref == branch {
+				return pr.Number, nil
+			}
+		}
+		if len(out) < 50 {
+			return 0, nil
+		}
+	}
+}
+
+func (giteaForge) GetPR(number int) (*PR, error) {
+	jsonBody, err := httpGET(fmt.Sprintf("%v/pulls/%v", giteaRepoURL(), number))
+	if err != nil {
+		return nil, err
+	}
+	var out PR
+	if err = json.Unmarshal(jsonBody, &out); err != nil {
+		return nil, errorf("failed to parse request body: %v", err)
+	}
+	out.Draft = regexpGiteaWIPPrefix.MatchString(out.Title)
+	if title := regexpGiteaWIPPrefix.ReplaceAllString(out.Title, ""); regexpDraft.MatchString(title) {
+		out.Title = title // the prefix was added by giteaTitle
+	}
+	return &out, nil
+}
+
+func (f giteaForge) CreatePR(commit, prev *Commit) error {
+	// another run may have just created the PR for this branch
+	number, err := f.GetPRNumberByHead(commit.GetRemoteRef())
+	if err != nil {
+		return err
+	}
+	if number != 0 {
+		fmt.Printf("pull request #%v already exists for %q\n", number, commit.Title)
+		commit.PRNumber = number
+		return f.editPR(number, map[string]any{"base": prBase(prev)})
+	}
+
+	fmt.Printf("create pull request for %q\n", commit.Title)
+	jsonBody, err := httpPOST(giteaRepoURL()+"/pulls", map[string]any{
+		"title": giteaTitle(commit.Title),
+		"body":  newPRBody(commit),
+		"head":  commit.GetRemoteRef(),
+		"base":  prBase(prev),
+	})
+	if err != nil {
+		return err
+	}
+	var out PR
+	if err = json.Unmarshal(jsonBody, &out); err != nil {
+		return errorf("failed to parse request body: %v", err)
+	}
+	commit.PRNumber = out.Number
+	if tags := commit.GetTags(config.Tags...); len(tags) > 0 {
+		return f.AddLabels(out.Number, tags...)
+	}
+	return nil
+}
+
+func (f giteaForge) UpdateBase(commit, prev *Commit) error {
+	number, err := f.GetPRNumber(commit, prev)
+	if err != nil {
+		return err
+	}
+	return f.editPR(number, map[string]any{"base": prBase(prev)})
+}
+
+func (giteaForge) editPR(number int, fields map[string]any) error {
+	_, err := httpRequest("PATCH", fmt.Sprintf("%v/pulls/%v", giteaRepoURL(), number), fields)
+	return err
+}
+
+func (f giteaForge) UpdatePR(number int, title, body string) error {
+	return f.editPR(number, map[string]any{"title": giteaTitle(title), "body": body})
+}
+
+// AddLabels adds the existing labels of the repository to the PR, by id. Unlike GitHub, Gitea doesn't create the
+// missing ones.
+func (giteaForge) AddLabels(number int, labels ...string) error {
+	jsonBody, err := httpGET(giteaRepoURL() + "/labels?limit=50")
+	if err != nil {
+		return err
+	}
+	var existing []struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	}
+	if err = json.Unmarshal(jsonBody, &existing); err != nil {
+		return errorf("failed to parse request body: %v", err)
+	}
+	var ids []int64
+	for _, label := range existing {
+		if containsString(labels, label.Name) {
+			ids = append(ids, label.ID)
+		}
+	}
+	if len(ids) < len(labels) {
+		fmt.Printf("skip the labels missing in %v (requested: %v)\n", config.Repo, strings.Join(labels, ", "))
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err = httpPOST(fmt.Sprintf("%v/issues/%v/labels", giteaRepoURL(), number), map[string]any{"labels": ids})
+	return err
+}
+
+func (giteaForge) ListChecks(ref string) ([]CheckRun, error) {
+	jsonBody, err := httpGET(fmt.Sprintf("%v/commits/%v/statuses?limit=50", giteaRepoURL(), ref))
+	if err != nil {
+		return nil, err
+	}
+	var out []GiteaStatus
+	if err = json.Unmarshal(jsonBody, &out); err != nil {
+		return nil, errorf("failed to parse request body: %v", err)
+	}
+	// the statuses are listed from the newest, keep the latest one of each context
+	var runs []CheckRun
+	seen := map[string]bool{}
+	for i := range out {
+		if !seen[out[i].Context] {
+			seen[out[i].Context] = true
+			runs = append(runs, out[i].toCheckRun())
+		}
+	}
+	return runs, nil
+}
+
+// MergePR merges the PR, then reads its merge commit, as the merge endpoint returns nothing.
+func (f giteaForge) MergePR(number int, method, sha, message string) (string, error) {
+	title, msg, _ := strings.Cut(message, "\n")
+	_, err := httpPOST(fmt.Sprintf("%v/pulls/%v/merge", giteaRepoURL(), number), map[string]any{
+		"Do":                        method,
+		"MergeTitleField":           title,
+		"MergeMessageField":         strings.TrimSpace(msg),
+		"head_commit_id":            sha,
+		"delete_branch_after_merge": false,
+	})
+	if err != nil {
+		return "", err
+	}
+	pr, err := f.GetPR(number)
+	if err != nil {
+		return "", err
+	}
+	return pr.MergeCommitSHA, nil
+}
+
+func (giteaForge) DeleteBranch(branch string) error {
+	_, err := httpRequest("DELETE", fmt.Sprintf("%v/branches/%v", giteaRepoURL(), url.PathEscape(branch)), nil)
+	return err
+}
+
+// SearchPR searches the PRs as issues, as the PRs can not be searched, and matches the title exactly.
+func (giteaForge) SearchPR(title string) (int, error) {
+	jsonBody, err := httpGET(fmt.Sprintf("%v/issues?type=pulls&state=open&q=%v", giteaRepoURL(), url.QueryEscape(title)))
+	if err != nil {
+		return 0, err
+	}
+	var out []struct {
+		Number int    `json:"number"`
+		Title  string `json:"title"`
+	}
+	if err = json.Unmarshal(jsonBody, &out); err != nil {
+		return 0, errorf("failed to parse request body: %v", err)
+	}
+	for _, issue := range out {
+		if issue.Title == title || issue.Title == giteaTitle(title) {
+			return issue.Number, nil
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestGiteaTitle(t *testing.T) {
+	tests := []struct {
+		title, want string
+	}{
+		{"Add the foo API", "Add the foo API"},
+		{"Add the foo API [draft]", "WIP: Add the foo API [draft]"},
+		{"WIP: Add the foo API [draft]", "WIP: Add the foo API [draft]"},
+	}
+	for _, tt := range tests {
+		if got := giteaTitle(tt.title); got != tt.want {
+			t.Errorf("giteaTitle(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestGiteaStatusToCheckRun(t *testing.T) {
+	tests := []struct {
+		status       GiteaStatus
+		wantStatus   string
+		wantConclude string
+	}{
+		{GiteaStatus{State: "pending"}, "in_progress", ""},
+		{GiteaStatus{State: "success"}, "completed", "success"},
+		{GiteaStatus{State: "warning"}, "completed", "neutral"},
+		{GiteaStatus{State: "error"}, "completed", "failure"},
+		{GiteaStatus{State: "failure"}, "completed", "failure"},
+	}
+	for _, tt := range tests {
+		run := tt.status.toCheckRun()
+		if run.Status != tt.wantStatus || run.Conclusion != tt.wantConclude {
+			t.Errorf("toCheckRun(%+v) = %v/%v, want %v/%v", tt.status, run.Status, run.Conclusion, tt.wantStatus, tt.wantConclude)
+		}
+	}
+}
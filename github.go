@@ -3,8 +3,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"regexp"
-	"strconv"
+	"net/url"
 	"strings"
 	"time"
 )
@@ -14,25 +13,102 @@ type NewPRBody struct {
 	Body  string `json:"body"`
 	Head  string `json:"head"`
 	Base  string `json:"base"`
+	Draft bool   `json:"draft"`
 }
 type PR struct {
 	Number int    `json:"number"`
+	NodeID string `json:"node_id"` // for the GraphQL API
+	Title  string `json:"title"`
 	Body   string `json:"body"`
-	Head   struct {
+	State  string `json:"state"`
+	Draft  bool   `json:"draft"`
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	Milestone          *Milestone `json:"milestone"`
+	RequestedReviewers []struct {
+		Login string `json:"login"`
+	} `json:"requested_reviewers"`
+	RequestedTeams []struct {
+		Slug string `json:"slug"`
+	} `json:"requested_teams"`
+	Head struct {
 		Ref string `json:"ref"`
+		Sha string `json:"sha"`
 	} `json:"head"`
-	UpdatedAt *time.Time
+	Base struct {
+		Ref  string `json:"ref"`
+		Repo struct {
+			FullName string `json:"full_name"`
+		} `json:"repo"`
+	} `json:"base"`
+	User struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	UpdatedAt      *time.Time `json:"updated_at"`
+	MergedAt       *time.Time `json:"merged_at"`
+	MergeCommitSHA string     `json:"merge_commit_sha"`
+
+	// only from the single PR endpoint
+	Mergeable      *bool  `json:"mergeable"`       // nil while GitHub is computing it
+	MergeableState string `json:"mergeable_state"` // clean, dirty (conflicts), blocked, behind, unstable, draft, ...
+}
+
+type Milestone struct {
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+}
+
+type Review struct {
+	User struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	State       string     `json:"state"` // APPROVED, CHANGES_REQUESTED, COMMENTED, DISMISSED, PENDING
+	SubmittedAt *time.Time `json:"submitted_at"`
+}
+
+type Repository struct {
+	FullName string `json:"full_name"`
+	Owner    struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+	SSHURL      string `json:"ssh_url"`
+	CloneURL    string `json:"clone_url"`
+	Permissions struct {
+		Push bool `json:"push"`
+	} `json:"permissions"`
+
+	// nil when not visible to the user
+	AllowSquashMerge *bool `json:"allow_squash_merge"`
+	AllowMergeCommit *bool `json:"allow_merge_commit"`
+	AllowRebaseMerge *bool `json:"allow_rebase_merge"`
+
+	DeleteBranchOnMerge    *bool  `json:"delete_branch_on_merge"`
+	SquashMergeCommitTitle string `json:"squash_merge_commit_title"` // PR_TITLE or COMMIT_OR_PR_TITLE
 }
 
 func githubGetPRNumberForCommit(commit, prev *Commit) (int, error) {
 	if commit.PRNumber != 0 {
 		return commit.PRNumber, nil
 	}
+	if commit.Skip {
+		number, err := foreignPRNumber(commit)
+		if err != nil || number != 0 {
+			return number, err
+		}
+	}
+	// the branch may point to another commit with the same change, when only the commit message changed
+	if remoteRef := commit.GetRemoteRef(); remoteRef != "" && !commit.Skip {
+		number, err := githubGetPRNumberByHead(remoteRef)
+		if err != nil || number != 0 {
+			return number, err
+		}
+	}
 	ghURL := fmt.Sprintf("https://api.%v/repos/%v/commits/%v/pulls?per_page=100", config.Host, config.Repo, commit.Hash)
 	jsonBody, err := httpGET(ghURL)
 	switch {
 	case err != nil && strings.Contains(err.Error(), "No commit found"):
-		return githubSearchPRNumberForCommit(commit)
+		return githubSearchPRNumberByTitle(commit.Title)
 	case err != nil:
 		return 0, err
 	}
@@ -52,7 +128,7 @@ func githubGetPRNumberForCommit(commit, prev *Commit) (int, error) {
 		}
 	}
 	if commit.Skip {
-		return githubSearchPRNumberForCommit(commit)
+		return githubSearchPRNumberByTitle(commit.Title)
 	}
 
 	// The commit was pushed and got "Everything up-to-date", try creating new pr
@@ -64,7 +140,12 @@ func githubGetPRNumberForCommit(commit, prev *Commit) (int, error) {
 }
 
 func githubGetPRByNumber(number int) (*PR, error) {
-	ghURL := fmt.Sprintf("https://api.%v/repos/%v/pulls/%d", config.Host, config.Repo, number)
+	return githubGetPRInRepo(config.Repo, number)
+}
+
+// githubGetPRInRepo gets a PR of another repository on the same host, e.g. for the "Depends-On:" trailers.
+func githubGetPRInRepo(repo string, number int) (*PR, error) {
+	ghURL := fmt.Sprintf("https://api.%v/repos/%v/pulls/%d", config.Host, repo, number)
 	jsonBody, err := httpGET(ghURL)
 	if err != nil {
 		return nil, err
@@ -80,38 +161,585 @@ func githubGetPRByNumber(number int) (*PR, error) {
 }
 
 func githubCreatePRForCommit(commit *Commit, prev *Commit) error {
-	base := config.MainBranch
-	if prev != nil {
-		base = prev.GetRemoteRef()
+	base := prBase(prev)
+
+	// another run may have just created the PR for this branch
+	number, err := githubGetPRNumberByHead(commit.GetRemoteRef())
+	if err != nil {
+		return err
 	}
-	args := []string{"pr", "create", "--title", commit.Title, "--body", "", "--head", commit.GetRemoteRef(), "--base", base}
-	if tags := commit.GetTags(config.Tags...); len(tags) > 0 {
-		args = append(args, "--label", strings.Join(tags, ","))
+	if number != 0 {
+		fmt.Printf("pull request #%v already exists for %q\n", number, commit.Title)
+		commit.PRNumber = number
+		return githubUpdateBase(number, base)
 	}
+
+	// create the PR as a draft with its body, then label it right away. It's marked ready for review at the end of
+	// the update of the PRs, after its reviewers and milestone are set, so that reviewers are notified once, of the
+	// final state. The PRs of the others' commits are left alone after that with git-pr.others-prs=keep: they are
+	// created in their final state.
 	fmt.Printf("create pull request for %q\n", commit.Title)
-	_, err := execGh(args...)
+	keptPR := config.OthersPRs == othersPRsKeep && !isMyOwnCommit(commit)
+	draft := regexpDraft.MatchString(commit.Title) || !keptPR
+	newPR := NewPRBody{Title: commit.Title, Body: newPRBody(commit), Head: prHead(commit), Base: base, Draft: draft}
+	out, err := githubCreatePR(newPR)
+	if err != nil && strings.Contains(err.Error(), "Draft pull requests are not supported") {
+		newPR.Draft = false // e.g. private repositories on the free plan
+		out, err = githubCreatePR(newPR)
+	}
+	if err != nil {
+		return err
+	}
+	commit.PRNumber = out.Number
+	if tags := commit.GetTags(config.Tags...); len(tags) > 0 {
+		return githubAddLabels(out.Number, tags...)
+	}
+	return nil
+}
+
+func githubCreatePR(body NewPRBody) (*PR, error) {
+	ghURL := fmt.Sprintf("https://api.%v/repos/%v/pulls", config.Host, config.Repo)
+	jsonBody, err := httpPOST(ghURL, body)
+	if err != nil {
+		return nil, err
+	}
+	var out PR
+	if err = json.Unmarshal(jsonBody, &out); err != nil {
+		return nil, errorf("failed to parse request body: %v", err)
+	}
+	return &out, nil
+}
+
+func githubClosePR(number int) error {
+	ghURL := fmt.Sprintf("https://api.%v/repos/%v/pulls/%v", config.Host, config.Repo, number)
+	_, err := httpRequest("PATCH", ghURL, map[string]any{"state": "closed"})
+	return err
+}
+
+// githubAddLabels adds the labels to the PR, creating the missing ones in the repository.
+func githubAddLabels(number int, labels ...string) error {
+	ghURL := fmt.Sprintf("https://api.%v/repos/%v/issues/%v/labels", config.Host, config.Repo, number)
+	_, err := httpPOST(ghURL, map[string]any{"labels": labels})
 	return err
 }
 
+// githubSetDraft converts the PR to a draft or marks it ready for review. The REST API can not change the draft state
+// of an existing PR, so it goes through GraphQL.
+func githubSetDraft(pr *PR, draft bool) error {
+	mutation := `mutation($id: ID!) { markPullRequestReadyForReview(input: {pullRequestId: $id}) { clientMutationId } }`
+	if draft {
+		mutation = `mutation($id: ID!) { convertPullRequestToDraft(input: {pullRequestId: $id}) { clientMutationId } }`
+	}
+	return githubGraphQL(mutation, map[string]any{"id": pr.NodeID}, nil)
+}
+
+// MissingLabels returns the labels which are not set on the PR yet.
+func (pr *PR) MissingLabels(labels []string) (missing []string) {
+	for _, label := range labels {
+		found := false
+		for _, l := range pr.Labels {
+			found = found || l.Name == label
+		}
+		if !found {
+			missing = append(missing, label)
+		}
+	}
+	return missing
+}
+
 func githubPRUpdateBaseForCommit(commit *Commit, prev *Commit) error {
-	base := xif(prev != nil, prev.GetRemoteRef(), config.MainBranch)
 	prNumber := must(githubGetPRNumberForCommit(commit, prev))
-	_, err := execGh("pr", "edit", strconv.Itoa(prNumber), "--base", base)
-	return err
+	return githubUpdateBase(prNumber, prBase(prev))
 }
 
-var regexpNumber = regexp.MustCompile(`[0-9]+`)
+// githubUpdateBase changes the base branch of the PR.
+func githubUpdateBase(number int, base string) error {
+	ghURL := fmt.Sprintf("https://api.%v/repos/%v/pulls/%v", config.Host, config.Repo, number)
+	_, err := httpRequest("PATCH", ghURL, map[string]any{"base": base})
+	return err
+}
 
-func githubSearchPRNumberForCommit(commit *Commit) (int, error) {
-	query := fmt.Sprintf("in:title %v", commit.Title)
-	result, err := execGh("pr", "list", "--limit=1", "--search", query)
+// githubSearchPRNumberByTitle returns the latest open PR with the words of the title in its title, or 0 if none. The
+// search is best effort: its errors are ignored.
+func githubSearchPRNumberByTitle(title string) (int, error) {
+	query := fmt.Sprintf("repo:%v is:pr is:open in:title %v", config.Repo, title)
+	ghURL := fmt.Sprintf("https://api.%v/search/issues?sort=created&order=desc&per_page=1&q=%v", config.Host, url.QueryEscape(query))
+	jsonBody, err := httpGET(ghURL)
 	if err != nil {
-		debugf("failed to search PR for commit (ignored) %q: %v\n", commit.Title, err)
+		debugf("failed to search PR for commit (ignored) %q: %v\n", title, err)
 		return 0, nil
 	}
-	s := regexpNumber.FindString(result)
-	if s == "" {
+	var out struct {
+		Items []struct {
+			Number int `json:"number"`
+		} `json:"items"`
+	}
+	if err = json.Unmarshal(jsonBody, &out); err != nil || len(out.Items) == 0 {
 		return 0, nil
 	}
-	return must(strconv.Atoi(s)), nil
+	return out.Items[0].Number, nil
+}
+
+func githubAddAssignees(number int, users ...string) error {
+	ghURL := fmt.Sprintf("https://api.%v/repos/%v/issues/%v/assignees", config.Host, config.Repo, number)
+	_, err := httpPOST(ghURL, map[string]any{"assignees": users})
+	return err
+}
+
+func githubRemoveAssignees(number int, users ...string) error {
+	ghURL := fmt.Sprintf("https://api.%v/repos/%v/issues/%v/assignees", config.Host, config.Repo, number)
+	_, err := httpRequest("DELETE", ghURL, map[string]any{"assignees": users})
+	return err
+}
+
+func githubCreateComment(number int, body string) error {
+	ghURL := fmt.Sprintf("https://api.%v/repos/%v/issues/%v/comments", config.Host, config.Repo, number)
+	_, err := httpPOST(ghURL, map[string]any{"body": body})
+	return err
+}
+
+// githubCreateBranch creates the branch at the commit, in the fork when pushing to a fork.
+func githubCreateBranch(branch, sha string) error {
+	ghURL := fmt.Sprintf("https://api.%v/repos/%v/git/refs", config.Host, headRepo())
+	_, err := httpPOST(ghURL, map[string]any{"ref": "refs/heads/" + branch, "sha": sha})
+	return err
+}
+
+// githubDeleteBranch deletes the branch, in the fork when pushing to a fork.
+func githubDeleteBranch(branch string) error {
+	_, err := httpRequest("DELETE", fmt.Sprintf("https://api.%v/repos/%v/git/refs/heads/%v", config.Host, headRepo(), branch), nil)
+	return err
+}
+
+func githubGetRepo(fullName string) (*Repository, error) {
+	ghURL := fmt.Sprintf("https://api.%v/repos/%v", config.Host, fullName)
+	jsonBody, err := httpGET(ghURL)
+	if err != nil {
+		return nil, err
+	}
+	var out Repository
+	err = json.Unmarshal(jsonBody, &out)
+	if err != nil {
+		return nil, errorf("failed to parse request body: %v", err)
+	}
+	return &out, nil
+}
+
+// githubCreateFork forks the repository to the user's account, or returns the existing fork.
+func githubCreateFork() (*Repository, error) {
+	ghURL := fmt.Sprintf("https://api.%v/repos/%v/forks", config.Host, config.Repo)
+	jsonBody, err := httpPOST(ghURL, map[string]any{})
+	if err != nil {
+		return nil, err
+	}
+	var out Repository
+	err = json.Unmarshal(jsonBody, &out)
+	if err != nil {
+		return nil, errorf("failed to parse request body: %v", err)
+	}
+	return &out, nil
+}
+
+// githubCreateReview submits a review with event "APPROVE", "REQUEST_CHANGES", or "COMMENT".
+func githubCreateReview(number int, event, body string) error {
+	ghURL := fmt.Sprintf("https://api.%v/repos/%v/pulls/%v/reviews", config.Host, config.Repo, number)
+	_, err := httpPOST(ghURL, map[string]any{"event": event, "body": body})
+	return err
+}
+
+func githubListReviews(number int) ([]Review, error) {
+	ghURL := fmt.Sprintf("https://api.%v/repos/%v/pulls/%v/reviews?per_page=100", config.Host, config.Repo, number)
+	jsonBody, err := httpGET(ghURL)
+	if err != nil {
+		return nil, err
+	}
+	var out []Review
+	err = json.Unmarshal(jsonBody, &out)
+	if err != nil {
+		return nil, errorf("failed to parse request body: %v", err)
+	}
+	return out, nil
+}
+
+// RequiredReviews are the review requirements for merging into a branch.
+type RequiredReviews struct {
+	Approvals  int
+	CodeOwners bool
+}
+
+// githubGetRequiredReviews reads the review requirements of the branch from both the rulesets and the classic branch
+// protection. The latter requires admin access, so it's ignored when not visible to the user.
+func githubGetRequiredReviews(branch string) (out RequiredReviews, _ error) {
+	rulesURL := fmt.Sprintf("https://api.%v/repos/%v/rules/branches/%v", config.Host, config.Repo, branch)
+	jsonBody, found, err := httpGETOptional(rulesURL)
+	if err != nil {
+		return out, err
+	}
+	if found {
+		var rules []struct {
+			Type       string `json:"type"`
+			Parameters struct {
+				RequiredApprovingReviewCount int  `json:"required_approving_review_count"`
+				RequireCodeOwnerReview       bool `json:"require_code_owner_review"`
+			} `json:"parameters"`
+		}
+		if err = json.Unmarshal(jsonBody, &rules); err != nil {
+			return out, errorf("failed to parse request body: %v", err)
+		}
+		for _, rule := range rules {
+			if rule.Type == "pull_request" {
+				out.Approvals = xif(rule.Parameters.RequiredApprovingReviewCount > out.Approvals, rule.Parameters.RequiredApprovingReviewCount, out.Approvals)
+				out.CodeOwners = out.CodeOwners || rule.Parameters.RequireCodeOwnerReview
+			}
+		}
+	}
+
+	protectionURL := fmt.Sprintf("https://api.%v/repos/%v/branches/%v/protection/required_pull_request_reviews", config.Host, config.Repo, branch)
+	jsonBody, found, err = httpGETOptional(protectionURL)
+	if err != nil {
+		return out, err
+	}
+	if found {
+		var protection struct {
+			RequiredApprovingReviewCount int  `json:"required_approving_review_count"`
+			RequireCodeOwnerReviews      bool `json:"require_code_owner_reviews"`
+		}
+		if err = json.Unmarshal(jsonBody, &protection); err != nil {
+			return out, errorf("failed to parse request body: %v", err)
+		}
+		out.Approvals = xif(protection.RequiredApprovingReviewCount > out.Approvals, protection.RequiredApprovingReviewCount, out.Approvals)
+		out.CodeOwners = out.CodeOwners || protection.RequireCodeOwnerReviews
+	}
+	return out, nil
+}
+
+type BranchRule struct {
+	Type       string `json:"type"`
+	Parameters struct {
+		RequiredStatusChecks []struct {
+			Context string `json:"context"`
+		} `json:"required_status_checks"`
+		StrictRequiredStatusChecksPolicy bool     `json:"strict_required_status_checks_policy"`
+		AllowedMergeMethods              []string `json:"allowed_merge_methods"`            // pull_request: merge, squash, rebase
+		RequiredDeploymentEnvironments   []string `json:"required_deployment_environments"` // required_deployments
+	} `json:"parameters"`
+}
+
+// BranchProtection is the classic branch protection, only visible to the admins of the repository.
+type BranchProtection struct {
+	RequiredLinearHistory struct {
+		Enabled bool `json:"enabled"`
+	} `json:"required_linear_history"`
+	RequiredStatusChecks *struct {
+		Strict bool `json:"strict"`
+	} `json:"required_status_checks"`
+}
+
+// githubGetBranchProtection returns the classic protection of the branch, or nil when it has none or it's not visible.
+func githubGetBranchProtection(branch string) (*BranchProtection, error) {
+	protectionURL := fmt.Sprintf("https://api.%v/repos/%v/branches/%v/protection", config.Host, config.Repo, branch)
+	jsonBody, found, err := httpGETOptional(protectionURL)
+	if err != nil || !found {
+		return nil, err
+	}
+	var out BranchProtection
+	if err = json.Unmarshal(jsonBody, &out); err != nil {
+		return nil, errorf("failed to parse request body: %v", err)
+	}
+	return &out, nil
+}
+
+// githubGetBranchRules returns the ruleset rules which apply to the branch, even when it does not exist yet.
+func githubGetBranchRules(branch string) ([]BranchRule, error) {
+	rulesURL := fmt.Sprintf("https://api.%v/repos/%v/rules/branches/%v", config.Host, config.Repo, branch)
+	jsonBody, found, err := httpGETOptional(rulesURL)
+	if err != nil || !found {
+		return nil, err
+	}
+	var rules []BranchRule
+	if err = json.Unmarshal(jsonBody, &rules); err != nil {
+		return nil, errorf("failed to parse request body: %v", err)
+	}
+	return rules, nil
+}
+
+// githubGetRequiredChecks lists the status checks required to merge into the branch, from both the rulesets and the
+// classic branch protection (when visible to the user).
+func githubGetRequiredChecks(branch string) (checks []string, _ error) {
+	rules, err := githubGetBranchRules(branch)
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		for _, check := range rule.Parameters.RequiredStatusChecks {
+			if !containsString(checks, check.Context) {
+				checks = append(checks, check.Context)
+			}
+		}
+	}
+	protectionURL := fmt.Sprintf("https://api.%v/repos/%v/branches/%v/protection/required_status_checks", config.Host, config.Repo, branch)
+	jsonBody, found, err := httpGETOptional(protectionURL)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		var protection struct {
+			Contexts []string `json:"contexts"`
+		}
+		if err = json.Unmarshal(jsonBody, &protection); err != nil {
+			return nil, errorf("failed to parse request body: %v", err)
+		}
+		for _, check := range protection.Contexts {
+			if !containsString(checks, check) {
+				checks = append(checks, check)
+			}
+		}
+	}
+	return checks, nil
+}
+
+// githubRequiresSignatures tells whether the commits merged into the branch must have verified signatures, from
+// either the rulesets or the classic branch protection (when visible to the user).
+func githubRequiresSignatures(branch string) (bool, error) {
+	rules, err := githubGetBranchRules(branch)
+	if err != nil {
+		return false, err
+	}
+	for _, rule := range rules {
+		if rule.Type == "required_signatures" {
+			return true, nil
+		}
+	}
+	protectionURL := fmt.Sprintf("https://api.%v/repos/%v/branches/%v/protection/required_signatures", config.Host, config.Repo, branch)
+	jsonBody, found, err := httpGETOptional(protectionURL)
+	if err != nil || !found {
+		return false, err
+	}
+	var protection struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err = json.Unmarshal(jsonBody, &protection); err != nil {
+		return false, errorf("failed to parse request body: %v", err)
+	}
+	return protection.Enabled, nil
+}
+
+// Verification is the signature verification of a commit by GitHub. The reason is "valid" when verified, otherwise
+// e.g. "unsigned", "unknown_key", or "bad_email".
+type Verification struct {
+	Verified bool   `json:"verified"`
+	Reason   string `json:"reason"`
+}
+
+// GitHubCommit is a pushed commit, with its signature verification by GitHub.
+type GitHubCommit struct {
+	SHA    string `json:"sha"`
+	Commit struct {
+		Author struct {
+			Name  string `json:"name"`
+			Email string `json:"email"`
+		} `json:"author"`
+		Message      string       `json:"message"`
+		Verification Verification `json:"verification"`
+	} `json:"commit"`
+	Committer *struct {
+		Login string `json:"login"`
+	} `json:"committer"` // nil when the committer email is not linked to an account
+}
+
+func githubGetCommit(sha string) (*GitHubCommit, error) {
+	ghURL := fmt.Sprintf("https://api.%v/repos/%v/commits/%v", config.Host, config.Repo, sha)
+	jsonBody, err := httpGET(ghURL)
+	if err != nil {
+		return nil, err
+	}
+	var out GitHubCommit
+	if err = json.Unmarshal(jsonBody, &out); err != nil {
+		return nil, errorf("failed to parse request body: %v", err)
+	}
+	return &out, nil
+}
+
+// githubListPRCommits lists the commits of the PR, up to 250 (the limit of GitHub).
+func githubListPRCommits(number int) ([]GitHubCommit, error) {
+	var commits []GitHubCommit
+	for page := 1; page <= 3; page++ {
+		ghURL := fmt.Sprintf("https://api.%v/repos/%v/pulls/%v/commits?per_page=100&page=%v", config.Host, config.Repo, number, page)
+		jsonBody, err := httpGET(ghURL)
+		if err != nil {
+			return nil, err
+		}
+		var out []GitHubCommit
+		if err = json.Unmarshal(jsonBody, &out); err != nil {
+			return nil, errorf("failed to parse request body: %v", err)
+		}
+		commits = append(commits, out...)
+		if len(out) < 100 {
+			break
+		}
+	}
+	return commits, nil
+}
+
+// githubGetCommitVerification returns the signature verification of a pushed commit.
+func githubGetCommitVerification(sha string) (Verification, error) {
+	commit, err := githubGetCommit(sha)
+	if err != nil {
+		return Verification{}, err
+	}
+	return commit.Commit.Verification, nil
+}
+
+type Comment struct {
+	ID   int64  `json:"id"`
+	Body string `json:"body"`
+}
+
+func githubListComments(number int) ([]Comment, error) {
+	ghURL := fmt.Sprintf("https://api.%v/repos/%v/issues/%v/comments?per_page=100", config.Host, config.Repo, number)
+	jsonBody, err := httpGET(ghURL)
+	if err != nil {
+		return nil, err
+	}
+	var out []Comment
+	err = json.Unmarshal(jsonBody, &out)
+	if err != nil {
+		return nil, errorf("failed to parse request body: %v", err)
+	}
+	return out, nil
+}
+
+// githubUpsertComment updates the comment containing the marker, or creates a new one.
+func githubUpsertComment(number int, marker, body string) error {
+	comments, err := githubListComments(number)
+	if err != nil {
+		return err
+	}
+	body = marker + "\n" + body
+	for _, comment := range comments {
+		if strings.Contains(comment.Body, marker) {
+			ghURL := fmt.Sprintf("https://api.%v/repos/%v/issues/comments/%v", config.Host, config.Repo, comment.ID)
+			_, err = httpRequest("PATCH", ghURL, map[string]any{"body": body})
+			return err
+		}
+	}
+	return githubCreateComment(number, body)
+}
+
+type CheckRun struct {
+	Name        string     `json:"name"`
+	Status      string     `json:"status"`     // queued, in_progress, completed
+	Conclusion  string     `json:"conclusion"` // success, failure, neutral, cancelled, skipped, timed_out, action_required
+	StartedAt   *time.Time `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+}
+
+// Duration returns how long the check took, or 0 if it's not completed.
+func (c *CheckRun) Duration() time.Duration {
+	if c.Status != "completed" || c.StartedAt == nil || c.CompletedAt == nil {
+		return 0
+	}
+	return c.CompletedAt.Sub(*c.StartedAt)
+}
+
+func githubListCheckRuns(ref string) ([]CheckRun, error) {
+	ghURL := fmt.Sprintf("https://api.%v/repos/%v/commits/%v/check-runs?per_page=100", config.Host, config.Repo, ref)
+	jsonBody, err := httpGET(ghURL)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		CheckRuns []CheckRun `json:"check_runs"`
+	}
+	err = json.Unmarshal(jsonBody, &out)
+	if err != nil {
+		return nil, errorf("failed to parse request body: %v", err)
+	}
+	return out.CheckRuns, nil
+}
+
+// githubDispatchWorkflow triggers a workflow_dispatch event for the workflow (id or file name) on the ref.
+func githubDispatchWorkflow(workflow, ref string, inputs map[string]string) error {
+	ghURL := fmt.Sprintf("https://api.%v/repos/%v/actions/workflows/%v/dispatches", config.Host, config.Repo, workflow)
+	body := map[string]any{"ref": ref}
+	if len(inputs) > 0 {
+		body["inputs"] = inputs
+	}
+	_, err := httpPOST(ghURL, body)
+	return err
+}
+
+// githubMergePR merges the PR with the method ("merge", "squash", or "rebase") and returns the new commit on the base
+// branch. The sha makes GitHub refuse to merge when the head changed in the meantime. An empty title keeps the title
+// from the repository settings.
+func githubMergePR(number int, method, sha, message string) (mergedSHA string, _ error) {
+	ghURL := fmt.Sprintf("https://api.%v/repos/%v/pulls/%v/merge", config.Host, config.Repo, number)
+	body := map[string]any{"merge_method": method, "sha": sha}
+	if title, msg, _ := strings.Cut(message, "\n"); title != "" {
+		body["commit_title"] = title
+		if msg = strings.TrimSpace(msg); msg != "" {
+			body["commit_message"] = msg
+		}
+	}
+	jsonBody, err := httpRequest("PUT", ghURL, body)
+	if err != nil {
+		return "", err
+	}
+	var out struct {
+		SHA string `json:"sha"`
+	}
+	if err = json.Unmarshal(jsonBody, &out); err != nil {
+		return "", errorf("failed to parse request body: %v", err)
+	}
+	return out.SHA, nil
+}
+
+// githubFindMilestone finds the open milestone with the title, or returns nil if not found.
+func githubFindMilestone(title string) (*Milestone, error) {
+	ghURL := fmt.Sprintf("https://api.%v/repos/%v/milestones?state=open&per_page=100", config.Host, config.Repo)
+	jsonBody, err := httpGET(ghURL)
+	if err != nil {
+		return nil, err
+	}
+	var out []Milestone
+	err = json.Unmarshal(jsonBody, &out)
+	if err != nil {
+		return nil, errorf("failed to parse request body: %v", err)
+	}
+	for i := range out {
+		if out[i].Title == title {
+			return &out[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func githubSetMilestone(number, milestone int) error {
+	ghURL := fmt.Sprintf("https://api.%v/repos/%v/issues/%v", config.Host, config.Repo, number)
+	_, err := httpRequest("PATCH", ghURL, map[string]any{"milestone": milestone})
+	return err
+}
+
+func githubRequestReviewers(number int, users, teams []string) error {
+	ghURL := fmt.Sprintf("https://api.%v/repos/%v/pulls/%v/requested_reviewers", config.Host, config.Repo, number)
+	_, err := httpPOST(ghURL, map[string]any{"reviewers": users, "team_reviewers": teams})
+	return err
+}
+
+// githubGetBranchSHA returns the commit of the pushed branch as seen by the API, which lags behind the push. The branch
+// is in the fork when pushing to a fork.
+func githubGetBranchSHA(branch string) (string, error) {
+	jsonBody, found, err := httpGETOptional(fmt.Sprintf("https://api.%v/repos/%v/git/ref/heads/%v", config.Host, headRepo(), branch))
+	if err != nil || !found {
+		return "", err
+	}
+	var out struct {
+		Object struct {
+			SHA string `json:"sha"`
+		} `json:"object"`
+	}
+	if err = json.Unmarshal(jsonBody, &out); err != nil {
+		return "", errorf("failed to parse request body: %v", err)
+	}
+	return out.Object.SHA, nil
 }
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// MergeRequest is a GitLab merge request, the counterpart of a GitHub PR.
+type MergeRequest struct {
+	IID          int      `json:"iid"`
+	Title        string   `json:"title"`
+	Description  string   `json:"description"`
+	State        string   `json:"state"` // opened, closed, locked, merged
+	Draft        bool     `json:"draft"`
+	SourceBranch string   `json:"source_branch"`
+	TargetBranch string   `json:"target_branch"`
+	SHA          string   `json:"sha"`
+	Labels       []string `json:"labels"`
+	Author       struct {
+		Username string `json:"username"`
+	} `json:"author"`
+	UpdatedAt       *time.Time `json:"updated_at"`
+	MergedAt        *time.Time `json:"merged_at"`
+	MergeCommitSHA  string     `json:"merge_commit_sha"`
+	SquashCommitSHA string     `json:"squash_commit_sha"`
+}
+
+// GitLab makes a merge request a draft with a prefix in its title
+var regexpGitLabDraftPrefix = regexp.MustCompile(`(?i)^(draft:|\[draft]|\(draft\))\s*`)
+
+// gitlabTitle returns the title of the merge request for the commit title: "[draft]" anywhere in the title makes the
+// PR a draft on GitHub, but only as a prefix on GitLab.
+func gitlabTitle(title string) string {
+	if regexpDraft.MatchString(title) && !regexpGitLabDraftPrefix.MatchString(title) {
+		return "Draft: " + title
+	}
+	return title
+}
+
+// toPR converts the merge request to a PR, with the title of the commit.
+func (mr *MergeRequest) toPR() *PR {
+	pr := &PR{Number: mr.IID, Title: mr.Title, Body: mr.Description, Draft: mr.Draft, UpdatedAt: mr.UpdatedAt, MergedAt: mr.MergedAt}
+	if title := regexpGitLabDraftPrefix.ReplaceAllString(mr.Title, ""); regexpDraft.MatchString(title) {
+		pr.Title = title // the prefix was added by gitlabTitle
+	}
+	pr.State = xif(mr.State == "opened", "open", mr.State)
+	pr.Head.Ref, pr.Head.Sha = mr.SourceBranch, mr.SHA
+	pr.Base.Ref = mr.TargetBranch
+	pr.User.Login = mr.Author.Username
+	pr.MergeCommitSHA = coalesce(mr.MergeCommitSHA, mr.SquashCommitSHA)
+	for _, label := range mr.Labels {
+		pr.Labels = append(pr.Labels, struct {
+			Name string `json:"name"`
+		}{label})
+	}
+	return pr
+}
+
+// CommitStatus is the status of a job of the GitLab pipelines on a commit.
+type CommitStatus struct {
+	Name         string     `json:"name"`
+	Status       string     `json:"status"` // created, pending, running, success, failed, canceled, skipped, manual
+	AllowFailure bool       `json:"allow_failure"`
+	StartedAt    *time.Time `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at"`
+}
+
+// toCheckRun converts the status to a GitHub check run, for waiting on the checks and summarizing them.
+func (s *CommitStatus) toCheckRun() CheckRun {
+	run := CheckRun{Name: s.Name, Status: "completed", StartedAt: s.StartedAt, CompletedAt: s.FinishedAt}
+	switch s.Status {
+	case "created", "pending", "waiting_for_resource", "preparing", "scheduled":
+		run.Status = "queued"
+	case "running":
+		run.Status = "in_progress"
+	case "success":
+		run.Conclusion = "success"
+	case "failed":
+		run.Conclusion = xif(s.AllowFailure, "neutral", "failure")
+	case "canceled":
+		run.Conclusion = "cancelled"
+	case "skipped":
+		run.Conclusion = "skipped"
+	default: // manual jobs don't block the merge
+		run.Conclusion = "neutral"
+	}
+	return run
+}
+
+type gitlabForge struct{}
+
+func gitlabProjectURL() string {
+	return fmt.Sprintf("https://%v/api/v4/projects/%v", config.Host, url.PathEscape(config.Repo))
+}
+
+func (gitlabForge) PRURL(number int) string {
+	return fmt.Sprintf("https://%v/%v/-/merge_requests/%v", config.Host, config.Repo, number)
+}
+
+func (gitlabForge) CommitURL(hash string) string {
+	return fmt.Sprintf("https://%v/%v/-/commit/%v", config.Host, config.Repo, hash)
+}
+
+func (gitlabForge) PRRef(number int) string {
+	return fmt.Sprintf("!%v", number)
+}
+
+func (f gitlabForge) GetPRNumber(commit, prev *Commit) (int, error) {
+	if commit.PRNumber != 0 {
+		return commit.PRNumber, nil
+	}
+	number, err := f.GetPRNumberByHead(commit.GetRemoteRef())
+	if err != nil || number != 0 || commit.Skip {
+		return number, err
+	}
+	// the commit was pushed and got "Everything up-to-date", try creating new merge request
+	if err = f.CreatePR(commit, prev); err != nil {
+		return 0, err
+	}
+	return commit.PRNumber, nil
+}
+
+func (gitlabForge) GetPRNumberByHead(branch string) (int, error) {
+	if branch == "" {
+		return 0, nil
+	}
+	glURL := fmt.Sprintf("%v/merge_requests?state=opened&source_branch=%v", gitlabProjectURL(), url.QueryEscape(branch))
+	jsonBody, err := httpGET(glURL)
+	if err != nil {
+		return 0, err
+	}
+	var out []MergeRequest
+	if err = json.Unmarshal(jsonBody, &out); err != nil {
+		return 0, errorf("failed to parse request body: %v", err)
+	}
+	if len(out) == 0 {
+		return 0, nil
+	}
+	return out[0].IID, nil
+}
+
+func (gitlabForge) GetPR(number int) (*PR, error) {
+	jsonBody, err := httpGET(fmt.Sprintf("%v/merge_requests/%v", gitlabProjectURL(), number))
+	if err != nil {
+		return nil, err
+	}
+	var out MergeRequest
+	if err = json.Unmarshal(jsonBody, &out); err != nil {
+		return nil, errorf("failed to parse request body: %v", err)
+	}
+	return out.toPR(), nil
+}
+
+func (f gitlabForge) CreatePR(commit, prev *Commit) error {
+	// another run may have just created the merge request for this branch
+	number, err := f.GetPRNumberByHead(commit.GetRemoteRef())
+	if err != nil {
+		return err
+	}
+	if number != 0 {
+		fmt.Printf("merge request !%v already exists for %q\n", number, commit.Title)
+		commit.PRNumber = number
+		return f.updateTarget(number, prBase(prev))
+	}
+
+	fmt.Printf("create merge request for %q\n", commit.Title)
+	jsonBody, err := httpPOST(gitlabProjectURL()+"/merge_requests", map[string]any{
+		"source_branch": commit.GetRemoteRef(),
+		"target_branch": prBase(prev),
+		"title":         gitlabTitle(commit.Title),
+		"description":   newPRBody(commit),
+		"labels":        strings.Join(commit.GetTags(config.Tags...), ","),
+	})
+	if err != nil {
+		return err
+	}
+	var out MergeRequest
+	if err = json.Unmarshal(jsonBody, &out); err != nil {
+		return errorf("failed to parse request body: %v", err)
+	}
+	commit.PRNumber = out.IID
+	return nil
+}
+
+func (f gitlabForge) UpdateBase(commit, prev *Commit) error {
+	number, err := f.GetPRNumber(commit, prev)
+	if err != nil {
+		return err
+	}
+	return f.updateTarget(number, prBase(prev))
+}
+
+func (gitlabForge) updateTarget(number int, base string) error {
+	_, err := httpRequest("PUT", fmt.Sprintf("%v/merge_requests/%v", gitlabProjectURL(), number), map[string]any{"target_branch": base})
+	return err
+}
+
+func (gitlabForge) UpdatePR(number int, title, body string) error {
+	_, err := httpRequest("PUT", fmt.Sprintf("%v/merge_requests/%v", gitlabProjectURL(), number), map[string]any{
+		"title":       gitlabTitle(title),
+		"description": body,
+	})
+	return err
+}
+
+func (gitlabForge) AddLabels(number int, labels ...string) error {
+	_, err := httpRequest("PUT", fmt.Sprintf("%v/merge_requests/%v", gitlabProjectURL(), number), map[string]any{
+		"add_labels": strings.Join(labels, ","),
+	})
+	return err
+}
+
+func (gitlabForge) ListChecks(ref string) ([]CheckRun, error) {
+	glURL := fmt.Sprintf("%v/repository/commits/%v/statuses?per_page=100", gitlabProjectURL(), url.PathEscape(ref))
+	jsonBody, err := httpGET(glURL)
+	if err != nil {
+		return nil, err
+	}
+	var out []CommitStatus
+	if err = json.Unmarshal(jsonBody, &out); err != nil {
+		return nil, errorf("failed to parse request body: %v", err)
+	}
+	runs := make([]CheckRun, len(out))
+	for i := range out {
+		runs[i] = out[i].toCheckRun()
+	}
+	return runs, nil
+}
+
+func (gitlabForge) MergePR(number int, method, sha, message string) (string, error) {
+	glURL := fmt.Sprintf("%v/merge_requests/%v/merge", gitlabProjectURL(), number)
+	body := map[string]any{"sha": sha, "squash": method == "squash"}
+	if method == "squash" {
+		body["squash_commit_message"] = message
+	} else {
+		body["merge_commit_message"] = message
+	}
+	jsonBody, err := httpRequest("PUT", glURL, body)
+	if err != nil {
+		return "", err
+	}
+	var out MergeRequest
+	if err = json.Unmarshal(jsonBody, &out); err != nil {
+		return "", errorf("failed to parse request body: %v", err)
+	}
+	// with fast-forward merges, there is no merge commit and the squash commit (or the head) is on the main branch
+	return coalesce(out.MergeCommitSHA, coalesce(out.SquashCommitSHA, out.SHA)), nil
+}
+
+func (gitlabForge) DeleteBranch(branch string) error {
+	_, err := httpRequest("DELETE", fmt.Sprintf("%v/repository/branches/%v", gitlabProjectURL(), url.PathEscape(branch)), nil)
+	return err
+}
+
+// SearchPR matches the title exactly, as the search of GitLab matches the words.
+func (gitlabForge) SearchPR(title string) (int, error) {
+	glURL := fmt.Sprintf("%v/merge_requests?state=opened&in=title&search=%v", gitlabProjectURL(), url.QueryEscape(title))
+	jsonBody, err := httpGET(glURL)
+	if err != nil {
+		return 0, err
+	}
+	var out []MergeRequest
+	if err = json.Unmarshal(jsonBody, &out); err != nil {
+		return 0, errorf("failed to parse request body: %v", err)
+	}
+	for i := range out {
+		if out[i].toPR().Title == title {
+			return out[i].IID, nil
+		}
+	}
+	return 0, nil
+}
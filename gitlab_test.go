@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestGitLabTitle(t *testing.T) {
+	tests := []struct {
+		title, want, pr string
+	}{
+		{"Add the foo API", "Add the foo API", "Add the foo API"},
+		{"Add the foo API [draft]", "Draft: Add the foo API [draft]", "Add the foo API [draft]"},
+		{"[Draft] Add the foo API", "[Draft] Add the foo API", "[Draft] Add the foo API"},
+	}
+	for _, tt := range tests {
+		got := gitlabTitle(tt.title)
+		if got != tt.want {
+			t.Errorf("gitlabTitle(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+		// the title of the PR is the commit title again, to not update the merge request for nothing
+		if pr := (&MergeRequest{Title: got}).toPR(); pr.Title != tt.pr {
+			t.Errorf("toPR(%q).Title = %q, want %q", got, pr.Title, tt.pr)
+		}
+	}
+}
+
+func TestCommitStatusToCheckRun(t *testing.T) {
+	tests := []struct {
+		status       CommitStatus
+		wantStatus   string
+		wantConclude string
+	}{
+		{CommitStatus{Status: "pending"}, "queued", ""},
+		{CommitStatus{Status: "running"}, "in_progress", ""},
+		{CommitStatus{Status: "success"}, "completed", "success"},
+		{CommitStatus{Status: "failed"}, "completed", "failure"},
+		{CommitStatus{Status: "failed", AllowFailure: true}, "completed", "neutral"},
+		{CommitStatus{Status: "manual"}, "completed", "neutral"},
+	}
+	for _, tt := range tests {
+		run := tt.status.toCheckRun()
+		if run.Status != tt.wantStatus || run.Conclusion != tt.wantConclude {
+			t.Errorf("toCheckRun(%+v) = %v/%v, want %v/%v", tt.status, run.Status, run.Conclusion, tt.wantStatus, tt.wantConclude)
+		}
+	}
+}
@@ -4,6 +4,7 @@ go 1.20
 
 require (
 	github.com/tidwall/gjson v1.14.4
+	github.com/zalando/go-keyring v0.2.3
 	gopkg.in/yaml.v3 v3.0.1
 )
 
@@ -13,6 +14,5 @@ require (
 	github.com/godbus/dbus/v5 v5.1.0 // indirect
 	github.com/tidwall/match v1.1.1 // indirect
 	github.com/tidwall/pretty v1.2.0 // indirect
-	github.com/zalando/go-keyring v0.2.3 // indirect
 	golang.org/x/sys v0.8.0 // indirect
 )
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// GraphQLError is the errors of a GraphQL response, which GitHub returns with a 200 status, e.g. when a PR does not
+// exist or the token lacks a scope.
+type GraphQLError struct {
+	Errors []struct {
+		Type       string `json:"type"` // e.g. NOT_FOUND, FORBIDDEN
+		Message    string `json:"message"`
+		Path       []any  `json:"path"`
+		Extensions struct {
+			Code      string `json:"code"` // e.g. undefinedField, when the field is missing from the schema
+			FieldName string `json:"fieldName"`
+		} `json:"extensions"`
+	} `json:"errors"`
+}
+
+// undefinedFields returns the fields which the schema doesn't have, e.g. on older GitHub Enterprise Server versions.
+// The whole query is rejected then.
+func (e *GraphQLError) undefinedFields() (fields []string) {
+	for _, err := range e.Errors {
+		if err.Extensions.Code == "undefinedField" && err.Extensions.FieldName != "" && !containsString(fields, err.Extensions.FieldName) {
+			fields = append(fields, err.Extensions.FieldName)
+		}
+	}
+	return fields
+}
+
+func (e *GraphQLError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Message
+	}
+	return "graphql: " + strings.Join(messages, "; ")
+}
+
+// githubGraphQL runs the query or mutation with the variables, and decodes the data of the response into out (nil to
+// ignore it). The data is decoded even with errors, as GitHub returns the fields which did not fail.
+func githubGraphQL(query string, variables map[string]any, out any) error {
+	ghURL := fmt.Sprintf("https://api.%v/graphql", config.Host)
+	jsonBody, err := httpPOST(ghURL, map[string]any{"query": query, "variables": variables})
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		Data json.RawMessage `json:"data"`
+		GraphQLError
+	}
+	if err = json.Unmarshal(jsonBody, &resp); err != nil {
+		return errorf("failed to parse request body: %v", err)
+	}
+	if out != nil && len(resp.Data) > 0 && string(resp.Data) != "null" {
+		if err = json.Unmarshal(resp.Data, out); err != nil {
+			return errorf("failed to parse graphql data: %v", err)
+		}
+	}
+	if len(resp.Errors) > 0 {
+		return &resp.GraphQLError
+	}
+	return nil
+}
+
+// pullRequestsQuery builds the query of the fields of many PRs of the repository at once, aliased "pr<number>": one
+// request instead of one per PR of the stack.
+func pullRequestsQuery(numbers []int, fields string) string {
+	numbers = append([]int(nil), numbers...)
+	sort.Ints(numbers)
+	var b strings.Builder
+	b.WriteString("query($owner: String!, $name: String!) {\n  repository(owner: $owner, name: $name) {\n")
+	for i, number := range numbers {
+		if i > 0 && number == numbers[i-1] {
+			continue
+		}
+		fmt.Fprintf(&b, "    pr%v: pullRequest(number: %v) { %v }\n", number, number, fields)
+	}
+	b.WriteString("  }\n}")
+	return b.String()
+}
+
+// PRState is the state of a PR for submitting and landing it, from GraphQL: the merge state tells why GitHub would
+// refuse to merge, which the REST API only tells as "blocked".
+type PRState struct {
+	Number           int    `json:"number"`
+	State            string `json:"state"` // OPEN, CLOSED, MERGED
+	IsDraft          bool   `json:"isDraft"`
+	HeadRefOid       string `json:"headRefOid"`
+	BaseRefName      string `json:"baseRefName"`
+	MergeStateStatus string `json:"mergeStateStatus"` // BEHIND, BLOCKED, CLEAN, DIRTY, DRAFT, HAS_HOOKS, UNKNOWN, UNSTABLE
+	ReviewDecision   string `json:"reviewDecision"`   // APPROVED, CHANGES_REQUESTED, REVIEW_REQUIRED, or "" when not required
+}
+
+// prStateFields are the fields of PRState to query. The fields missing from the schema of the server are dropped
+// after the first query, and left empty: e.g. without mergeStateStatus, describeMergeState can't tell.
+var prStateFields = []string{"number", "state", "isDraft", "headRefOid", "baseRefName", "mergeStateStatus", "reviewDecision"}
+
+// githubGetPRStates returns the states of the PRs by number, in one request.
+func githubGetPRStates(numbers []int) (map[int]*PRState, error) {
+	out := map[int]*PRState{}
+	if len(numbers) == 0 {
+		return out, nil
+	}
+	owner, name, _ := strings.Cut(config.Repo, "/")
+	var data struct {
+		Repository map[string]*PRState `json:"repository"`
+	}
+	for {
+		err := githubGraphQL(pullRequestsQuery(numbers, strings.Join(prStateFields, " ")), map[string]any{"owner": owner, "name": name}, &data)
+		if err == nil {
+			break
+		}
+		var gqlErr *GraphQLError
+		if !errors.As(err, &gqlErr) {
+			return nil, err
+		}
+		missing := gqlErr.undefinedFields()
+		var fields []string
+		for _, field := range prStateFields {
+			if !containsString(missing, field) {
+				fields = append(fields, field)
+			}
+		}
+		if len(fields) == len(prStateFields) {
+			return nil, err
+		}
+		debugf("the GraphQL schema has no %v: query the PR states without them\n", strings.Join(missing, ", "))
+		prStateFields = fields
+	}
+	for _, state := range data.Repository {
+		if state != nil {
+			out[state.Number] = state
+		}
+	}
+	return out, nil
+}
+
+// describeMergeState explains why GitHub would refuse to merge the PR, or returns "" when it would not (or can't tell).
+func describeMergeState(state *PRState) string {
+	switch state.MergeStateStatus {
+	case "DIRTY":
+		return "conflicts with " + state.BaseRefName
+	case "BEHIND":
+		return "behind " + state.BaseRefName + " (the base branch requires it to be up-to-date)"
+	case "DRAFT":
+		return "still a draft"
+	case "BLOCKED":
+		switch state.ReviewDecision {
+		case "REVIEW_REQUIRED":
+			return "blocked by the required reviews"
+		case "CHANGES_REQUESTED":
+			return "blocked by the requested changes"
+		}
+		return "blocked by the branch protection (required checks, deployments, or conversation resolution)"
+	}
+	return ""
+}
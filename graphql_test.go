@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestPullRequestsQuery(t *testing.T) {
+	got := pullRequestsQuery([]int{12, 7, 12}, "number headRefOid")
+	want := `query($owner: String!, $name: String!) {
+  repository(owner: $owner, name: $name) {
+    pr7: pullRequest(number: 7) { number headRefOid }
+    pr12: pullRequest(number: 12) { number headRefOid }
+  }
+}`
+	if got != want {
+		t.Errorf("pullRequestsQuery() =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestDescribeMergeState(t *testing.T) {
+	tests := []struct {
+		state PRState
+		want  string
+	}{
+		{PRState{MergeStateStatus: "CLEAN"}, ""},
+		{PRState{MergeStateStatus: "DIRTY", BaseRefName: "main"}, "conflicts with main"},
+		{PRState{MergeStateStatus: "BLOCKED", ReviewDecision: "REVIEW_REQUIRED"}, "blocked by the required reviews"},
+		{PRState{MergeStateStatus: "BLOCKED", ReviewDecision: "APPROVED"}, "blocked by the branch protection (required checks, deployments, or conversation resolution)"},
+	}
+	for _, tt := range tests {
+		if got := describeMergeState(&tt.state); got != tt.want {
+			t.Errorf("describeMergeState(%+v) = %q, want %q", tt.state, got, tt.want)
+		}
+	}
+}
+
+func TestUndefinedFields(t *testing.T) {
+	var resp struct{ GraphQLError }
+	body := `{"errors": [
+		{"message": "Field 'mergeStateStatus' doesn't exist on type 'PullRequest'", "extensions": {"code": "undefinedField", "typeName": "PullRequest", "fieldName": "mergeStateStatus"}},
+		{"message": "Field 'mergeStateStatus' doesn't exist on type 'PullRequest'", "extensions": {"code": "undefinedField", "typeName": "PullRequest", "fieldName": "mergeStateStatus"}},
+		{"type": "NOT_FOUND", "message": "Could not resolve to a PullRequest with the number of 3."}
+	]}`
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.undefinedFields(); !reflect.DeepEqual(got, []string{"mergeStateStatus"}) {
+		t.Errorf("undefinedFields() = %v, want [mergeStateStatus]", got)
+	}
+}
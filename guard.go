@@ -0,0 +1,409 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// flattenMergeCommits offers to rebase the stack onto the main branch when it has merge commits, e.g. from an
+// accidental "git merge main" or "git pull": pushing them as PRs is never what the user wants.
+func flattenMergeCommits(originMain string) {
+	merges := strings.Fields(must(execGit("rev-list", "--merges", originMain+".."+head)))
+	if len(merges) == 0 {
+		return
+	}
+	fmt.Printf("⚠️  the stack has %v merge %v:\n", len(merges), xif(len(merges) == 1, "commit", "commits"))
+	for _, hash := range merges {
+		fmt.Printf("  %v\n", strings.TrimSpace(must(execGit("log", "-1", "--format=%h %s", hash))))
+	}
+	if !promptYesNo(fmt.Sprintf("Flatten the stack by rebasing it onto %v, dropping the merges?", originMain)) {
+		exitf("aborted, nothing was pushed\n\nHint: a stack must be linear, rebase it onto %v", originMain)
+	}
+	if _, err := execGit("rebase", originMain); err != nil {
+		exitCodef(ExitConflict, `failed to rebase the stack onto %v
+
+Hint: resolve the conflicts and run "git rebase --continue", then "git pr"`, originMain)
+	}
+	fmt.Println()
+}
+
+// checkRevertedCommits warns when a commit of the stack was already landed through its PR and then reverted on the
+// main branch: submitting it again would effectively re-land the reverted code. The closed PRs of the commits are
+// listed concurrently, and the warnings printed in the order of the stack.
+func checkRevertedCommits(commits []*Commit) {
+	originMain := fmt.Sprintf("%v/%v", config.Remote, config.MainBranch)
+	warnings := make([][]string, len(commits))
+	var wg sync.WaitGroup
+	for i, commit := range commits {
+		i, commit := i, commit
+		remoteRef := commit.GetRemoteRef()
+		if remoteRef == "" {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer forwardErrors()
+			prs := must(githubListPRsByHead(headOwner(), remoteRef, "closed"))
+			for _, pr := range prs {
+				if pr.MergedAt == nil || pr.MergeCommitSHA == "" {
+					continue
+				}
+				revertHash := findRevertCommit(originMain, &pr)
+				if revertHash == "" {
+					continue
+				}
+				warnings[i] = append(warnings[i], fmt.Sprintf("⚠️  %v: #%v was merged as %v and reverted by %v on %v",
+					commit.ShortHash(), pr.Number, shortHash(pr.MergeCommitSHA), revertHash[:8], config.MainBranch))
+			}
+		}()
+	}
+	waitGoroutines(&wg)
+	found := false
+	for _, lines := range warnings {
+		for _, line := range lines {
+			found = true
+			fmt.Println(line)
+		}
+	}
+	if found && !promptYesNo("Submitting will re-land the reverted changes. Continue?") {
+		exitf("aborted")
+	}
+}
+
+// findRevertCommit finds the commit on the main branch which reverted the merged PR, by "git revert" message, GitHub's
+// revert button message, or the "Reverts:" trailer of "git pr revert".
+func findRevertCommit(mainRef string, pr *PR) string {
+	out, _ := execGit("log", mainRef, "-n", "1", "--format=%H", "--extended-regexp",
+		"--grep", "This reverts commit "+pr.MergeCommitSHA,
+		"--grep", fmt.Sprintf("Reverts %v#%v([^0-9]|$)", regexp.QuoteMeta(config.Repo), pr.Number),
+		"--grep", fmt.Sprintf("Reverts: #%v([^0-9]|$)", pr.Number),
+	)
+	return strings.TrimSpace(out)
+}
+
+// secretPatterns are the built-in patterns of common token formats. They are deliberately specific, to keep false
+// positives rare enough for blocking the push.
+var secretPatterns = []struct {
+	Kind    string
+	Pattern *regexp.Regexp
+}{
+	{"AWS access key", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"GitHub token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}|\bgithub_pat_[A-Za-z0-9_]{22,}`)},
+	{"GitLab token", regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}`)},
+	{"Slack token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{"Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`)},
+	{"Stripe key", regexp.MustCompile(`\b[rs]k_live_[0-9A-Za-z]{24,}`)},
+	{"private key", regexp.MustCompile(`-----BEGIN ([A-Z]+ )?PRIVATE KEY-----`)},
+}
+
+type secretFinding struct {
+	File string
+	Line int
+	Kind string
+}
+
+// checkSecrets blocks pushing commits which likely contain credentials, with the built-in patterns or the scanner
+// command from git config git-pr.secret-scanner. Force-pushed secrets stay reachable on GitHub, so it's checked before
+// anything is pushed.
+func checkSecrets(commits []*Commit) {
+	if config.SecretScanner == "" {
+		return
+	}
+	found := false
+	for _, commit := range commits {
+		patch := must(execGit("show", "--format=", "--no-color", "--no-ext-diff", "-U0", commit.Hash))
+		if config.SecretScanner != "builtin" {
+			out, err := execCommandWithInput(patch, "sh", "-c", config.SecretScanner)
+			if err != nil {
+				found = true
+				fmt.Printf("⚠️  %v: %v reported:\n%v\n", commit.ShortHash(), config.SecretScanner, strings.TrimSpace(out))
+			}
+			continue
+		}
+		for _, finding := range scanSecrets(patch) {
+			found = true
+			fmt.Printf("⚠️  %v: %v:%v looks like a %v\n", commit.ShortHash(), finding.File, finding.Line, finding.Kind)
+		}
+	}
+	if found {
+		exitCodef(ExitSecrets, `likely secrets found in the stack, nothing was pushed
+
+Hint: remove them with "git pr amend <commit>", or skip the check once with "git -c %v= pr"`, gitconfigSecretScanner)
+	}
+}
+
+// scanSecrets finds the added lines of the patch ("git show -U0") matching the built-in patterns.
+func scanSecrets(patch string) (findings []secretFinding) {
+	var file string
+	line := 0
+	for _, text := range strings.Split(patch, "\n") {
+		switch {
+		case strings.HasPrefix(text, "+++ "):
+			file = strings.TrimPrefix(strings.TrimPrefix(text, "+++ "), "b/")
+		case strings.HasPrefix(text, "@@ "):
+			if m := regexpHunkHeader.FindStringSubmatch(text); m != nil {
+				line, _ = strconv.Atoi(m[3])
+			}
+		case strings.HasPrefix(text, "+"):
+			for _, p := range secretPatterns {
+				if p.Pattern.MatchString(text) {
+					findings = append(findings, secretFinding{File: file, Line: line, Kind: p.Kind})
+					break
+				}
+			}
+			line++
+		}
+	}
+	return findings
+}
+
+// skipLandedCommits skips the commits which were already landed on the main branch (from another machine, or by
+// squash-merging the PR) but are still in the local stack, so that their PRs are not created again.
+func skipLandedCommits(commits []*Commit) {
+	originMain := fmt.Sprintf("%v/%v", config.Remote, config.MainBranch)
+	landed := must(getLandedCommits(originMain, head))
+	for _, commit := range commits {
+		if landed[commit.Hash] && !commit.Skip {
+			commit.Skip = true
+			fmt.Printf("skip \"%v\" (already landed on %v)\n", shortenTitle(commit.Title), originMain)
+		}
+	}
+}
+
+// rebaseAboveLanded handles the PR which now targets the main branch because the commits below it landed: its branch
+// still has the original commits, which conflict with their squash on the main branch. When the conflicts are only in
+// files untouched by the commit, the commits above the landed ones are replayed onto the main branch for their PRs,
+// without rebasing the local stack. It returns the hashes to push instead of the local ones.
+func rebaseAboveLanded(commits []*Commit, originMain string) (replayed map[string]string) {
+	var landed bool
+	var above []*Commit
+	for _, commit := range commits {
+		switch {
+		case commit.Skip && len(above) == 0:
+			landed = true
+		case landed:
+			above = append(above, commit)
+		}
+	}
+	if len(above) == 0 || config.BaseRev != "" {
+		return nil
+	}
+	conflicts, err := mergeConflicts(originMain, above[0].Hash)
+	if err != nil {
+		debugf("failed to check the conflicts of %v (ignored): %v\n", above[0].ShortHash(), err)
+		return nil
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	touched := must(execGit("diff-tree", "--no-commit-id", "--name-only", "-r", above[0].Hash))
+	for _, file := range conflicts {
+		if containsString(strings.Fields(touched), file) {
+			fmt.Printf("%v conflicts with %v in %v\n\nHint: run \"git pr sync\" to rebase the stack and resolve the conflicts\n\n",
+				above[0].ShortHash(), originMain, file)
+			return nil
+		}
+	}
+	replayed, err = replayCommits(above, originMain)
+	if err != nil {
+		fmt.Printf("can not rebase the PRs onto %v (%v)\n\nHint: run \"git pr sync\" to rebase the stack\n\n", originMain, err)
+		return nil
+	}
+	fmt.Printf("rebase the PRs above the landed commits onto %v, as they conflict in %v (the local stack is unchanged: run \"git pr sync\" to rebase it)\n",
+		originMain, strings.Join(conflicts, ", "))
+	return replayed
+}
+
+// mergeConflicts returns the files which conflict when merging the commit into the target, with "git merge-tree"
+// (git 2.38 or newer), without touching the checkout.
+func mergeConflicts(target, commit string) ([]string, error) {
+	out, err := execGit("merge-tree", "--write-tree", "--name-only", "--no-messages", target, commit)
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return nil, nil
+	case !errors.As(err, &exitErr) || exitErr.ExitCode() != 1: // 1 is for conflicts
+		return nil, err
+	}
+	// the first line is the tree, then the conflicted files
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	return lines[1:], nil
+}
+
+// checkCommitSizes warns about the commits which exceed the size limits from git config git-pr.max-lines and
+// git-pr.max-files, to nudge splitting them before asking for reviews. With -strict, nothing is pushed.
+func checkCommitSizes(commits []*Commit) {
+	if config.MaxLines <= 0 && config.MaxFiles <= 0 {
+		return
+	}
+	found := false
+	for _, commit := range commits {
+		if foreignStackToolOfCommit(commit) != "" || !(isMyOwnCommit(commit) || config.IncludeOtherAuthors) {
+			continue
+		}
+		stats := must(getCommitStats(commit.Hash))
+		if reason := sizeLimitReason(stats); reason != "" {
+			found = true
+			fmt.Printf("⚠️  %v: %v \"%v\"\n", commit.ShortHash(), reason, shortenTitle(commit.Title))
+		}
+	}
+	switch {
+	case found && config.Strict:
+		exitCodef(ExitTooLarge, "commits exceed the size limits, nothing was pushed\n\nHint: split them into smaller commits")
+	case found:
+		fmt.Println("consider splitting them into smaller commits for reviewers")
+	}
+}
+
+// sizeLimitReason returns why the commit is too large, or "" if it's within the limits.
+func sizeLimitReason(stats CommitStats) string {
+	var reasons []string
+	if lines := stats.Insertions + stats.Deletions; config.MaxLines > 0 && lines > config.MaxLines {
+		reasons = append(reasons, fmt.Sprintf("%v lines changed (max %v)", lines, config.MaxLines))
+	}
+	if config.MaxFiles > 0 && stats.Files > config.MaxFiles {
+		reasons = append(reasons, fmt.Sprintf("%v files changed (max %v)", stats.Files, config.MaxFiles))
+	}
+	return strings.Join(reasons, ", ")
+}
+
+// checkRepoCompatibility warns, before the first submit of a stack, about the repository settings which would make the
+// stack fail later: after creating all its PRs is a bad time to find out. remoteRef is the branch of the bottom commit.
+func checkRepoCompatibility(remoteRef string) {
+	repo := must(githubGetRepo(config.Repo))
+	var headRules []BranchRule
+	if config.HeadOwner == "" { // the branches are pushed to a fork, which has its own rules
+		headRules = must(githubGetBranchRules(remoteRef))
+	}
+	requiredChecks := must(githubGetRequiredChecks(config.MainBranch))
+	blocking, warnings := compatibilityIssues(repo, remoteRef, headRules, requiredChecks)
+	for _, warning := range warnings {
+		fmt.Printf("⚠️  %v\n", warning)
+	}
+	for _, issue := range blocking {
+		fmt.Printf("⛔ %v\n", issue)
+	}
+	if len(blocking) > 0 && !promptYesNo("The PRs could not be updated after submitting. Submit anyway?") {
+		exitf("aborted")
+	}
+}
+
+// compatibilityIssues returns the repository settings which prevent updating the stack (blocking), and those which only
+// get in the way.
+func compatibilityIssues(repo *Repository, remoteRef string, headRules []BranchRule, requiredChecks []string) (blocking, warnings []string) {
+	for _, rule := range headRules {
+		switch rule.Type {
+		case "non_fast_forward":
+			blocking = append(blocking, fmt.Sprintf("a ruleset blocks force-pushing to %v: the PRs can not be updated after amending or rebasing the stack", remoteRef))
+		case "update":
+			blocking = append(blocking, fmt.Sprintf("a ruleset restricts updating %v: the PRs can not be updated", remoteRef))
+		case "creation":
+			blocking = append(blocking, fmt.Sprintf("a ruleset restricts creating %v: the PRs can not be created", remoteRef))
+		}
+	}
+	if repo.AllowSquashMerge != nil && !*repo.AllowSquashMerge {
+		merge := xif(repo.AllowRebaseMerge != nil && *repo.AllowRebaseMerge, "rebase", "merge commits")
+		warnings = append(warnings, fmt.Sprintf("%v does not allow squash merging: \"git pr squash-land\" won't work, land the PRs from the bottom with %v", config.Repo, merge))
+	}
+	if len(requiredChecks) > 0 {
+		warnings = append(warnings, fmt.Sprintf("%v requires the checks %v: the PRs above the bottom of the stack are based on other branches, make sure the workflows run for them too (no \"branches\" filter on pull_request)",
+			config.MainBranch, strings.Join(requiredChecks, ", ")))
+	}
+	return blocking, warnings
+}
+
+// checkLandProtections explains the protections of the main branch which conflict with how squash-land merges, before
+// waiting for the checks, rather than failing to merge with a generic "blocked" at the end. The blocking ones exit.
+func checkLandProtections() {
+	repo := must(githubGetRepo(config.Repo))
+	rules := must(githubGetBranchRules(config.MainBranch))
+	protection := must(githubGetBranchProtection(config.MainBranch))
+	blocking, warnings := landProtectionConflicts(repo, rules, protection)
+	for _, warning := range warnings {
+		fmt.Printf("⚠️  %v\n", warning)
+	}
+	if len(blocking) > 0 {
+		exitf("can not land into %v:\n  - %v", config.MainBranch, strings.Join(blocking, "\n  - "))
+	}
+}
+
+// landProtectionConflicts returns the protections of the main branch which prevent squash-land from merging
+// (blocking), and those which may refuse the merge, each with the change to make.
+func landProtectionConflicts(repo *Repository, rules []BranchRule, protection *BranchProtection) (blocking, warnings []string) {
+	useBot := `or let a merge bot land the PRs with -external-merge`
+	linearHistory, upToDate := false, false
+	if protection != nil {
+		linearHistory = protection.RequiredLinearHistory.Enabled
+		upToDate = protection.RequiredStatusChecks != nil && protection.RequiredStatusChecks.Strict
+	}
+	for _, rule := range rules {
+		switch rule.Type {
+		case "merge_queue":
+			if !config.ExternalMerge {
+				blocking = append(blocking, fmt.Sprintf("%v requires a merge queue, which merges the PRs instead of squash-land: add the PR to the queue on GitHub, %v", config.MainBranch, useBot))
+			}
+		case "pull_request":
+			if methods := rule.Parameters.AllowedMergeMethods; len(methods) > 0 && !containsString(methods, "squash") && !config.ExternalMerge {
+				blocking = append(blocking, fmt.Sprintf("a ruleset of %v only allows the %v merge methods, but squash-land squash-merges: allow squash in the ruleset, %v", config.MainBranch, strings.Join(methods, " and "), useBot))
+			}
+		case "required_deployments":
+			warnings = append(warnings, fmt.Sprintf("%v requires successful deployments to %v before merging: deploy the PR first, or the merge is refused once the checks pass", config.MainBranch, strings.Join(rule.Parameters.RequiredDeploymentEnvironments, ", ")))
+		case "required_linear_history":
+			linearHistory = true
+		case "required_status_checks":
+			upToDate = upToDate || rule.Parameters.StrictRequiredStatusChecksPolicy
+		}
+	}
+	if repo.AllowSquashMerge != nil && !*repo.AllowSquashMerge && !config.ExternalMerge {
+		blocking = append(blocking, fmt.Sprintf("%v does not allow squash merging: enable it in the settings of the repository, %v", config.Repo, useBot))
+	}
+	if linearHistory && config.ExternalMerge {
+		warnings = append(warnings, fmt.Sprintf("%v requires a linear history: the merge bot must squash or rebase the PRs, its merge commits would be refused", config.MainBranch))
+	}
+	if upToDate {
+		warnings = append(warnings, fmt.Sprintf("%v requires the PRs to be up to date before merging: after landing a PR, land the next one of the stack from the updated %v (\"git pr\" restacks it)", config.MainBranch, config.MainBranch))
+	}
+	return blocking, warnings
+}
+
+const (
+	testPlanWarn    = "warn"
+	testPlanRequire = "require"
+)
+
+var regexpTestPlanHeading = regexp.MustCompile(`(?im)^(#+\s*)?test plan\b`)
+
+// checkTestPlans reports the commits to submit without a test plan, with git config git-pr.test-plan. With "require",
+// nothing is pushed.
+func checkTestPlans(commits []*Commit) {
+	if config.TestPlan == "" {
+		return
+	}
+	found := false
+	for _, commit := range commits {
+		if foreignStackToolOfCommit(commit) != "" || !(isMyOwnCommit(commit) || config.IncludeOtherAuthors) {
+			continue
+		}
+		if !hasTestPlan(commit) {
+			found = true
+			fmt.Printf("⚠️  %v: no test plan \"%v\"\n", commit.ShortHash(), shortenTitle(commit.Title))
+		}
+	}
+	switch {
+	case found && config.TestPlan == testPlanRequire:
+		exitCodef(ExitNoTestPlan, "commits without a test plan, nothing was pushed\n\nHint: add a \"Test-Plan:\" trailer, or a \"Test Plan\" section to the commit message")
+	case found:
+		fmt.Println("consider telling reviewers how the changes were tested")
+	}
+}
+
+// hasTestPlan reports whether the commit has a "Test-Plan:" trailer, or a "Test Plan" section in its message.
+func hasTestPlan(commit *Commit) bool {
+	return commit.GetAttr(KeyTestPlan) != "" || regexpTestPlanHeading.MatchString(commit.Message)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestScanSecrets(t *testing.T) {
+	awsKey := "AKIA" + "ABCDEFGHIJKLMNOP" // split to not trip scanners on this file
+	patch := `diff --git a/config.go b/config.go
+--- a/config.go
++++ b/config.go
+@@ -10,0 +11,2 @@ func load() {
++	region := "us-east-1"
++	key := "` + awsKey + `"
+@@ -20 +22 @@ func save() {
+-	old := "` + awsKey + `"
++	token := os.Getenv("TOKEN")
+`
+	findings := scanSecrets(patch)
+	if got := fmt.Sprint(findings); got != "[{config.go 12 AWS access key}]" {
+		t.Errorf("scanSecrets() = %v", got)
+	}
+}
+
+func TestCompatibilityIssues(t *testing.T) {
+	config.Repo, config.MainBranch = "acme/app", "main"
+	no := false
+	repo := &Repository{AllowSquashMerge: &no}
+	rules := []BranchRule{{Type: "non_fast_forward"}, {Type: "pull_request"}}
+	blocking, warnings := compatibilityIssues(repo, "alice/1a2b3c4d", rules, []string{"build"})
+	if len(blocking) != 1 || !strings.Contains(blocking[0], "force-pushing to alice/1a2b3c4d") {
+		t.Errorf("blocking = %q", blocking)
+	}
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "squash") || !strings.Contains(warnings[1], "build") {
+		t.Errorf("warnings = %q", warnings)
+	}
+
+	blocking, warnings = compatibilityIssues(&Repository{}, "alice/1a2b3c4d", nil, nil)
+	if len(blocking) != 0 || len(warnings) != 0 {
+		t.Errorf("unknown settings: blocking = %q, warnings = %q", blocking, warnings)
+	}
+}
+
+func TestLandProtectionConflicts(t *testing.T) {
+	config.Repo, config.MainBranch = "acme/app", "main"
+	defer func(external bool) { config.ExternalMerge = external }(config.ExternalMerge)
+	queue := BranchRule{Type: "merge_queue"}
+	mergeOnly := BranchRule{Type: "pull_request"}
+	mergeOnly.Parameters.AllowedMergeMethods = []string{"merge"}
+	protection := &BranchProtection{}
+	protection.RequiredLinearHistory.Enabled = true
+
+	config.ExternalMerge = false
+	blocking, warnings := landProtectionConflicts(&Repository{}, []BranchRule{queue, mergeOnly}, protection)
+	if len(blocking) != 2 || !strings.Contains(blocking[0], "merge queue") || !strings.Contains(blocking[1], "merge methods") {
+		t.Errorf("blocking = %q", blocking)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("warnings = %q, the squash merges keep the history linear", warnings)
+	}
+
+	config.ExternalMerge = true
+	blocking, warnings = landProtectionConflicts(&Repository{}, []BranchRule{queue, mergeOnly}, protection)
+	if len(blocking) != 0 || len(warnings) != 1 || !strings.Contains(warnings[0], "linear history") {
+		t.Errorf("with -external-merge: blocking = %q, warnings = %q", blocking, warnings)
+	}
+}
+
+func TestHasTestPlan(t *testing.T) {
+	tests := []struct {
+		commit *Commit
+		want   bool
+	}{
+		{&Commit{Message: "Fix the parser."}, false},
+		{&Commit{Message: "Fix the parser.", Attrs: []KeyVal{{KeyTestPlan, "go test ./parser"}}}, true},
+		{&Commit{Message: "Fix the parser.\n\n## Test plan\n\ngo test ./parser"}, true},
+		{&Commit{Message: "Fix the parser.\n\nTest Plan: go test ./parser"}, true},
+		{&Commit{Message: "Add the test plan to the docs."}, false},
+	}
+	for _, tt := range tests {
+		if got := hasTestPlan(tt.commit); got != tt.want {
+			t.Errorf("hasTestPlan(%q) = %v", tt.commit.Message, got)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+const githubStatusURL = "https://www.githubstatus.com/api/v2/components.json"
+
+// the GitHub components which git-pr depends on
+var githubStatusComponents = []string{"Git Operations", "API Requests", "Pull Requests", "Actions"}
+
+// maxServerErrors is the number of consecutive 5xx responses after which we stop, instead of spraying failed mutations
+// across the stack during an incident.
+const maxServerErrors = 3
+
+var serverErrors atomic.Int32
+
+// checkGitHubHealth warns before a large operation when githubstatus.com reports an incident on the components which
+// git-pr depends on. It's best-effort: failing to get the status is ignored, and GitHub Enterprise is not checked.
+func checkGitHubHealth() {
+	if config.Host != "github.com" {
+		return
+	}
+	degraded, err := getDegradedGitHubComponents()
+	if err != nil {
+		debugf("failed to get GitHub status (ignored): %v\n", err)
+		return
+	}
+	if len(degraded) == 0 {
+		return
+	}
+	fmt.Printf("⚠️  GitHub is reporting degraded %v service, see https://www.githubstatus.com\n", strings.Join(degraded, ", "))
+	if !promptYesNo("Continue anyway?") {
+		exitf("aborted")
+	}
+}
+
+func getDegradedGitHubComponents() (degraded []string, _ error) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", githubStatusURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req) // no token: this is not a GitHub API
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errorf("unexpected status %v", resp.Status)
+	}
+	var out struct {
+		Components []struct {
+			Name   string `json:"name"`
+			Status string `json:"status"` // operational, degraded_performance, partial_outage, major_outage
+		} `json:"components"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, errorf("failed to parse response: %v", err)
+	}
+	for _, component := range out.Components {
+		if component.Status != "operational" && containsString(githubStatusComponents, component.Name) {
+			degraded = append(degraded, fmt.Sprintf("%v (%v)", component.Name, strings.ReplaceAll(component.Status, "_", " ")))
+		}
+	}
+	return degraded, nil
+}
+
+// trackServerError counts the consecutive 5xx responses from GitHub and exits when there are too many.
+func trackServerError(status int) {
+	if status < 500 {
+		serverErrors.Store(0)
+		return
+	}
+	if serverErrors.Add(1) >= maxServerErrors {
+		exitf("GitHub keeps failing with %v, it may have an incident: try again later\n\nHint: see https://www.githubstatus.com", http.StatusText(status))
+	}
+}
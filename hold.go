@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// holdCommit adds (or removes) the "Hold: true" trailer of a commit of the stack. Held commits are submitted as usual
+// but never landed.
+func holdCommit(args []string, hold bool) {
+	command := xif(hold, "hold", "unhold")
+	if len(args) > 1 {
+		exitCodef(ExitConfig, "usage: git pr %v [commit]", command)
+	}
+	originMain := fmt.Sprintf("%v/%v", config.Remote, config.MainBranch)
+	stackedCommits := must(getStackedCommits(originMain, head))
+	if len(stackedCommits) == 0 {
+		exitf("no commits in the stack")
+	}
+	var target *Commit
+	if len(args) == 1 {
+		target = findStackedCommit(stackedCommits, args[0])
+		if target == nil {
+			exitCodef(ExitConfig, "commit %q not found in the stack", args[0])
+		}
+	} else {
+		target = chooseStackedCommit(stackedCommits, xif(hold, "Hold which commit?", "Unhold which commit?"))
+	}
+	if isHeld(target) == hold {
+		fmt.Printf("%v is already %v\n", target.ShortHash(), xif(hold, "on hold", "not on hold"))
+		return
+	}
+
+	if hold {
+		target.SetAttr(KeyHold, "true")
+	} else {
+		target.RemoveAttr(KeyHold)
+	}
+	fmt.Printf("%v %v\n", command, target)
+	must(execGit("reword", target.Hash, "-m", target.FullMessage()))
+	time.Sleep(500 * time.Millisecond)
+	fmt.Println(`run "git pr" to update the PRs`)
+}
+
+// isHeld reports whether the commit has the "Hold:" trailer, which blocks landing it.
+func isHeld(commit *Commit) bool {
+	switch strings.ToLower(commit.GetAttr(KeyHold)) {
+	case "true", "yes", "1":
+		return true
+	}
+	return false
+}
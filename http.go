@@ -4,10 +4,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxRateLimitRetries = 4
+	// maxRateLimitWait is the longest wait for the rate limit before giving up: the primary quota resets every hour
+	maxRateLimitWait = 5 * time.Minute
 )
 
 func httpGET(url string) ([]byte, error) {
@@ -18,7 +26,22 @@ func httpPOST(url string, body any) ([]byte, error) {
 	return httpRequest("POST", url, body)
 }
 
-func httpRequest(method string, url string, body any) (_ []byte, err error) {
+// httpGETOptional is like httpGET, but treats 403 and 404 as not found instead of errors, for resources which may not
+// exist or be visible to the user, like branch protection.
+func httpGETOptional(url string) (_ []byte, found bool, _ error) {
+	data, status, err := doHTTPRequest("GET", url, nil, true, 0)
+	if status == http.StatusForbidden || status == http.StatusNotFound {
+		return nil, false, nil
+	}
+	return data, err == nil, err
+}
+
+func httpRequest(method string, url string, body any) ([]byte, error) {
+	data, _, err := doHTTPRequest(method, url, body, false, 0)
+	return data, err
+}
+
+func doHTTPRequest(method string, url string, body any, quiet bool, attempt int) (_ []byte, status int, err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
 	defer cancel()
 
@@ -27,16 +50,16 @@ func httpRequest(method string, url string, body any) (_ []byte, err error) {
 	if body != nil {
 		bodyJSON, err = json.Marshal(body)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		bodyReader = bytes.NewReader(bodyJSON)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	req.Header.Set("Authorization", "Bearer "+config.Token)
+	req.Header.Set("Authorization", "Bearer "+githubToken())
 
 	debugf("-> %v %v\n", method, url)
 	if bodyJSON != nil {
@@ -44,19 +67,68 @@ func httpRequest(method string, url string, body any) (_ []byte, err error) {
 	}
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
+	defer resp.Body.Close()
+	countAPIRequest(apiCategory(method, url), resp.Header)
+	trackServerError(resp.StatusCode)
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
 		fmt.Println("failed to call http request:", err)
-		return nil, err
+		return nil, resp.StatusCode, err
 	}
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+	if remaining := resp.Header.Get("X-RateLimit-Remaining"); remaining != "" {
+		debugf("<- %v (rate limit: %v/%v remaining)\n", resp.Status, remaining, resp.Header.Get("X-RateLimit-Limit"))
+	} else {
 		debugf("<- %v\n", resp.Status)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
 		debugf("%v\n\n", string(data))
-		return data, err
+		return data, resp.StatusCode, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && refreshAppToken() {
+		return doHTTPRequest(method, url, body, quiet, attempt)
+	}
+	if wait, ok := rateLimitWait(resp.StatusCode, resp.Header, data, attempt, time.Now()); ok && attempt < maxRateLimitRetries {
+		fmt.Printf("rate limited by %v, retrying %v %v in %v...\n", forgeDisplayName(config.Forge), method, apiCategory(method, url), wait.Round(time.Second))
+		time.Sleep(wait)
+		return doHTTPRequest(method, url, body, quiet, attempt+1)
+	}
+	if resp.StatusCode == http.StatusUnauthorized && config.Forge != forgeGitHub {
+		token := forgeTokens[config.Forge]
+		exitCodef(ExitAuth, "%v rejected the token for %v (%v)\n\nHint: set %v to %v", forgeDisplayName(config.Forge), config.Host, resp.Status, token.Env, token.Desc)
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		exitCodef(ExitAuth, "GitHub rejected the token for %v (%v)\n\nHint: use github cli to login to your account:\n\n      gh auth login", config.Host, resp.Status)
+	}
+	if !quiet {
+		fmt.Println("failed to call http request:", url, resp.Status)
+		fmt.Println(string(data))
+	}
+	return data, resp.StatusCode, &HTTPError{Method: method, URL: url, Status: resp.Status, StatusCode: resp.StatusCode, Body: data}
+}
+
+// rateLimitWait returns how long to wait before retrying a rate-limited request, or false when the response is not
+// rate-limited or the wait would be too long. The secondary rate limits of GitHub (the abuse detection, e.g. when
+// creating many PRs quickly) return 403 with Retry-After, or without any header: then the wait doubles from 1 minute.
+func rateLimitWait(status int, header http.Header, body []byte, attempt int, now time.Time) (time.Duration, bool) {
+	if status != http.StatusTooManyRequests && status != http.StatusForbidden {
+		return 0, false
+	}
+	msg := strings.ToLower(string(body))
+	limited := status == http.StatusTooManyRequests || header.Get("X-RateLimit-Remaining") == "0" ||
+		strings.Contains(msg, "rate limit") || strings.Contains(msg, "abuse detection")
+	if !limited {
+		return 0, false // a permission error
+	}
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(header.Get("Retry-After")); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil && header.Get("X-RateLimit-Remaining") == "0" {
+		wait = time.Unix(reset, 0).Sub(now) + time.Second
+	} else {
+		wait = time.Minute << attempt
 	}
-	fmt.Println("failed to call http request:", url, resp.Status)
-	fmt.Println(string(data))
-	return data, errors.New(fmt.Sprintf("failed to call http request: (%v) %s", resp.Status, data))
+	wait = xif(wait < time.Second, time.Second, wait)
+	return wait, wait <= maxRateLimitWait
 }
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateLimitWait(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tests := []struct {
+		name    string
+		status  int
+		header  map[string]string
+		body    string
+		attempt int
+		want    time.Duration
+		wantOK  bool
+	}{
+		{"not limited", 404, nil, `{"message":"Not Found"}`, 0, 0, false},
+		{"permission", 403, nil, `{"message":"Resource not accessible by integration"}`, 0, 0, false},
+		{"retry-after", 403, map[string]string{"Retry-After": "30"}, `{"message":"You have exceeded a secondary rate limit"}`, 0, 30 * time.Second, true},
+		{"secondary", 403, nil, `{"message":"You have exceeded a secondary rate limit"}`, 1, 2 * time.Minute, true},
+		{"reset", 403, map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "1700000060"}, `{"message":"API rate limit exceeded"}`, 0, 61 * time.Second, true},
+		{"reset too far", 403, map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "1700003600"}, `{}`, 0, 3601 * time.Second, false},
+		{"too many requests", 429, map[string]string{"Retry-After": "0"}, ``, 0, time.Second, true},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		for k, v := range tt.header {
+			header.Set(k, v)
+		}
+		got, ok := rateLimitWait(tt.status, header, []byte(tt.body), tt.attempt, now)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("%v: rateLimitWait() = %v, %v, want %v, %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
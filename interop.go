@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// stackTool describes another stacking tool which may manage commits and PRs in the same repository. We never push,
+// reword, or rewrite the PR body of anything owned by these tools; we only link to their PRs in our stack footer.
+type stackTool struct {
+	Name string
+
+	// matches PR bodies generated by the tool
+	BodyMarker *regexp.Regexp
+
+	// trailer added by the tool to its commits
+	CommitTrailer string
+}
+
+var foreignStackTools = []stackTool{
+	{"spr", regexp.MustCompile(`github\.com/ejoffe/spr`), "commit-id"},
+	{"ghstack", regexp.MustCompile(`Stack from \[ghstack]|github\.com/ezyang/ghstack`), "ghstack-source-id"},
+	{"Graphite", regexp.MustCompile(`app\.graphite\.dev`), ""},
+	{"Sapling", regexp.MustCompile(`Stack created with \[Sapling]`), ""},
+}
+
+const (
+	mappingRemoteRef = "remote-ref"
+	mappingGhstack   = "ghstack"
+)
+
+// ghstack (and Phabricator-style tools) keep the PR link in the commit message
+var regexpPullRequestResolved = regexp.MustCompile(`(?m)^Pull Request resolved: https://[^/\s]+/[^/\s]+/[^/\s]+/pull/([0-9]+)\s*$`)
+
+// detectForeignStackTool returns the name of the tool which generated the PR body, or "" if the body is ours or
+// hand-written.
+func detectForeignStackTool(body string) string {
+	if prDelimiterRegexp.MatchString(body) {
+		return ""
+	}
+	for _, tool := range foreignStackTools {
+		if tool.BodyMarker.MatchString(body) && !isAdoptedStackTool(tool) {
+			return tool.Name
+		}
+	}
+	return ""
+}
+
+// isAdoptedStackTool reports whether we take over the commits and PRs of the tool, for teams migrating from it.
+func isAdoptedStackTool(tool stackTool) bool {
+	return tool.Name == "ghstack" && config.Mapping == mappingGhstack
+}
+
+// foreignStackToolOfCommit returns the name of the tool which manages the commit, or "" if none.
+func foreignStackToolOfCommit(commit *Commit) string {
+	for _, tool := range foreignStackTools {
+		if tool.CommitTrailer != "" && commit.GetAttr(tool.CommitTrailer) != "" && !isAdoptedStackTool(tool) {
+			return tool.Name
+		}
+	}
+	return ""
+}
+
+// foreignPRNumber finds the PR created by another tool for the commit, or returns 0 if not found.
+func foreignPRNumber(commit *Commit) (int, error) {
+	if m := regexpPullRequestResolved.FindStringSubmatch(commit.Message); m != nil {
+		return strconv.Atoi(m[1])
+	}
+	// spr pushes each commit to "spr/<main>/<commit-id>", in the upstream repository even when git-pr pushes to a fork
+	if commitID := commit.GetAttr("commit-id"); commitID != "" {
+		owner, _, _ := strings.Cut(config.Repo, "/")
+		prs, err := githubListPRsByHead(owner, fmt.Sprintf("spr/%v/%v", config.MainBranch, commitID), "open")
+		if err != nil || len(prs) == 0 {
+			return 0, err
+		}
+		return prs[0].Number, nil
+	}
+	return 0, nil
+}
+
+// githubGetPRNumberByHead finds the open PR with the given head branch in the current repository (or the fork when
+// pushing to a fork), or returns 0 if not found.
+func githubGetPRNumberByHead(branch string) (int, error) {
+	prs, err := githubListPRsByHead(headOwner(), branch, "open")
+	if err != nil || len(prs) == 0 {
+		return 0, err
+	}
+	return prs[0].Number, nil
+}
+
+// githubListPRsByHead lists the PRs with the given head branch of the owner and state ("open", "closed", or "all").
+func githubListPRsByHead(owner, branch, state string) ([]PR, error) {
+	ghURL := fmt.Sprintf("https://api.%v/repos/%v/pulls?state=%v&head=%v", config.Host, config.Repo, state, url.QueryEscape(owner+":"+branch))
+	jsonBody, err := httpGET(ghURL)
+	if err != nil {
+		return nil, err
+	}
+	var out []PR
+	err = json.Unmarshal(jsonBody, &out)
+	if err != nil {
+		return nil, errorf("failed to parse request body: %v", err)
+	}
+	return out, nil
+}
+
+// ghstackHeadRef returns the head branch of the PR created by ghstack for the commit ("gh/<user>/<n>/head") when the
+// mapping is "ghstack", so that git-pr pushes to it and keeps the existing PR instead of creating a new one. The base
+// of the PR is then changed from ghstack's synthetic base branch to the branch of the previous commit, as usual.
+func ghstackHeadRef(commit *Commit) string {
+	if config.Mapping != mappingGhstack || commit.GetAttr("ghstack-source-id") == "" {
+		return ""
+	}
+	m := regexpPullRequestResolved.FindStringSubmatch(commit.Message)
+	if m == nil {
+		return ""
+	}
+	pr := must(githubGetPRByNumber(must(strconv.Atoi(m[1]))))
+	if pr.State != "open" {
+		return ""
+	}
+	return pr.Head.Ref
+}
+
+var regexpGhstackHeader = regexp.MustCompile(`(?s)^Stack from \[ghstack]\([^)]*\)[^\n]*\n(\* [^\n]*\n)*\s*`)
+
+// stripGhstackHeader removes the stack list generated by ghstack at the top of the PR body, as git-pr has its own.
+func stripGhstackHeader(body string) string {
+	return regexpGhstackHeader.ReplaceAllString(body, "")
+}
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// squashLand submits a one-commit stack, waits for the checks, and squash-merges the PR in one go.
+func squashLand(args []string) {
+	if len(args) > 0 {
+		exitCodef(ExitConfig, "usage: git pr squash-land [-dry-run]")
+	}
+	if !config.DryRun {
+		ensureGitStatusClean()
+	}
+	originMain := fmt.Sprintf("%v/%v", config.Remote, config.MainBranch)
+	stackedCommits := must(getStackedCommits(originMain, head))
+	if len(stackedCommits) != 1 {
+		exitCodef(ExitConfig, `squash-land only works for a one-commit stack, found %v commits
+
+Hint: use "git pr" to submit the stack`, len(stackedCommits))
+	}
+	if !isMyOwnCommit(stackedCommits[0]) {
+		exitCodef(ExitConfig, "can not land the commit of %v", stackedCommits[0].AuthorEmail)
+	}
+	if config.DryRun {
+		if config.Forge != forgeGitHub {
+			exitCodef(ExitConfig, "-dry-run is only supported on GitHub")
+		}
+		planSquashLand(stackedCommits[0])
+		return
+	}
+	if isHeld(stackedCommits[0]) {
+		exitf("%v is on hold\n\nHint: use \"git pr unhold\" to land it", stackedCommits[0].ShortHash())
+	}
+	deletesBranch, titlesCommit := false, false
+	if config.Forge == forgeGitHub {
+		checkDependencies(stackedCommits[0])
+		checkLandProtections()
+		deletesBranch, titlesCommit = githubMergeSettings(must(githubGetRepo(config.Repo)))
+	}
+
+	// retargeting the PR to the main branch makes the required checks run again, on the same commit
+	var since time.Time
+	if remoteRef := stackedCommits[0].GetRemoteRef(); remoteRef != "" && config.Forge == forgeGitHub {
+		prs := must(githubListPRsByHead(headOwner(), remoteRef, "open"))
+		if len(prs) > 0 && prs[0].Base.Ref != config.MainBranch {
+			since = time.Now()
+		}
+	}
+
+	submitStack()
+	commit := must(getStackedCommits(originMain, head))[0]
+	number := must(forge.GetPRNumberByHead(commit.GetRemoteRef()))
+	if number == 0 {
+		exitf("no pull request found for %v", commit.GetRemoteRef())
+	}
+	// the head of the PR is not the local commit when only its message changed (it was not pushed again), or when it
+	// was replayed: the checks run on the head, and the merge must name it
+	headSHA := must(forge.GetPR(number)).Head.Sha
+	if full, err := execGit("rev-parse", "--verify", "--quiet", headSHA+"^{commit}"); err == nil {
+		headSHA = strings.TrimSpace(full) // Bitbucket returns a shortened hash
+	}
+	if config.Forge == forgeGitHub && must(githubRequiresSignatures(config.MainBranch)) {
+		if v := must(githubGetCommitVerification(headSHA)); !v.Verified {
+			exitf("%v can not be merged into %v: %v requires verified signatures, but the signature of %v is %v\n\nHint: %v",
+				commit.ShortHash(), config.MainBranch, config.MainBranch, commit.ShortHash(), strings.ReplaceAll(v.Reason, "_", " "), signatureHint(v.Reason))
+		}
+	}
+
+	title, message := fmt.Sprintf("%v (%v)", commit.Title, forge.PRRef(number)), ""
+	if titlesCommit {
+		title = commit.Title // only for printing: the squash commit message is kept from the repository settings
+	} else {
+		message = squashMessage(commit, title, number)
+	}
+	var mergedSHA string
+	for attempt := 0; !config.ExternalMerge; attempt++ {
+		fmt.Printf("\nwaiting for the checks of #%v...\n", number)
+		if failed := waitForChecks(headSHA, since); len(failed) > 0 {
+			exitCodef(ExitChecksFailed, "checks failed on #%v: %v", number, strings.Join(failed, ", "))
+		}
+		fmt.Printf("squash-merge #%v: %v\n", number, title)
+		var err error
+		mergedSHA, err = forge.MergePR(number, "squash", headSHA, message)
+		if err == nil {
+			break
+		}
+		// the required checks were reset after we saw them complete, e.g. by the base change: wait for them again
+		if attempt > 0 || !strings.Contains(err.Error(), "status check") {
+			var httpErr *HTTPError
+			if errors.As(err, &httpErr) && (httpErr.StatusCode == 405 || httpErr.StatusCode == 409) {
+				reason := httpErr.Message()
+				if config.Forge == forgeGitHub {
+					if states, err := githubGetPRStates([]int{number}); err == nil && states[number] != nil {
+						reason = coalesce(describeMergeState(states[number]), reason)
+					}
+				}
+				exitf("can not merge #%v: %v\n\nHint: run \"git pr squash-land -dry-run\" to see the blockers", number, reason)
+			}
+			must(0, err)
+		}
+		since = time.Now()
+	}
+	if config.ExternalMerge {
+		fmt.Printf("\nwaiting for the checks of #%v...\n", number)
+		if failed := waitForChecks(headSHA, since); len(failed) > 0 {
+			exitCodef(ExitChecksFailed, "checks failed on #%v: %v", number, strings.Join(failed, ", "))
+		}
+		mergedSHA = externalMerge(number)
+	}
+	commit.PRNumber = number
+	updateTrackingIssue([]*Commit{commit})
+	if !config.KeepBranches && !deletesBranch {
+		if err := forge.DeleteBranch(commit.GetRemoteRef()); err != nil {
+			fmt.Printf("failed to delete branch %v (ignored)\n", commit.GetRemoteRef())
+		}
+	}
+	if _, err := execGitRemote(config.Remote, "fetch", config.Remote, config.MainBranch); err != nil {
+		exitCodef(ExitPartialLand, "landed #%v, but failed to fetch %v: %v\n\nHint: run \"git fetch\" and check %v", number, originMain, err, originMain)
+	}
+	if full, err := execGit("rev-parse", "--verify", "--quiet", mergedSHA+"^{commit}"); err == nil {
+		mergedSHA = strings.TrimSpace(full) // Bitbucket returns a shortened hash
+	}
+	landed := &LandedPR{
+		PRNumber: number, Title: commit.Title, Hash: commit.Hash, RemoteRef: commit.GetRemoteRef(),
+		Stack: commit.GetAttr(KeyStack), TrunkSHA: mergedSHA, Time: time.Now(),
+	}
+	var problems []string
+	if problem := checkLandedPatch(commit, mergedSHA, headSHA); problem != "" {
+		problems = append(problems, problem)
+	}
+	if config.VerifyLand && config.Forge == forgeGitHub {
+		problems = append(problems, verifyLandedCommit(commit, mergedSHA, originMain)...)
+		verified := len(problems) == 0
+		landed.Verified = &verified
+	}
+	recordLandedPR(landed)
+	must(execGit("checkout", originMain))
+	if len(problems) > 0 {
+		exitCodef(ExitPartialLand, "landed #%v as %v, but it failed the verification:\n  - %v", number, shortHash(mergedSHA), strings.Join(problems, "\n  - "))
+	}
+	fmt.Printf("landed #%v as %v, now at %v\n", number, shortHash(mergedSHA), originMain)
+}
+
+// squashMessage returns the message of the squash commit: the title with the PR number, the commit message, and its
+// trailers without the ones of git-pr. On GitHub, a Co-authored-by trailer is added for each other author of the PR
+// commits (e.g. suggestions applied in the UI), as GitHub only adds them to its default message.
+func squashMessage(commit *Commit, title string, number int) string {
+	var b strings.Builder
+	fprint(&b, title, "\n\n", strings.TrimSpace(commit.Message), "\n\n")
+	coAuthors := map[string]bool{strings.ToLower(commit.AuthorEmail): true}
+	for _, kv := range commit.Attrs {
+		switch kv[0] {
+		case KeyRemoteRef, KeyStack, KeyTags, KeyHold:
+			continue
+		case KeyCoAuthoredBy:
+			coAuthors[strings.ToLower(trailerEmail(kv[1]))] = true
+			fprintf(&b, "Co-authored-by: %v\n", kv[1]) // with the case of the GitHub docs
+			continue
+		}
+		fprintf(&b, "%v: %v\n", formatKey(kv[0]), kv[1])
+	}
+	if config.Forge == forgeGitHub {
+		addCoAuthor := func(author string) {
+			if email := strings.ToLower(trailerEmail(author)); email != "" && !coAuthors[email] {
+				coAuthors[email] = true
+				fprintf(&b, "Co-authored-by: %v\n", author)
+			}
+		}
+		for _, prCommit := range must(githubListPRCommits(number)) {
+			author := prCommit.Commit.Author
+			addCoAuthor(fmt.Sprintf("%v <%v>", author.Name, author.Email))
+			for _, m := range regexpCoAuthoredBy.FindAllStringSubmatch(prCommit.Commit.Message, -1) {
+				addCoAuthor(strings.TrimSpace(m[1]))
+			}
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+var regexpCoAuthoredBy = regexp.MustCompile(`(?im)^co-authored-by:(.+)$`)
+
+// trailerEmail returns the email of a "Name <email>" trailer value.
+func trailerEmail(author string) string {
+	_, email, _ := strings.Cut(author, "<")
+	return strings.TrimSuffix(strings.TrimSpace(email), ">")
+}
+
+// githubMergeSettings returns what GitHub does itself when merging, from the repository settings: deleting the head
+// branch, and titling the squash commit. The settings are only visible to the users who can push.
+func githubMergeSettings(repo *Repository) (deletesBranch, titlesCommit bool) {
+	deletesBranch = repo.DeleteBranchOnMerge != nil && *repo.DeleteBranchOnMerge && config.HeadOwner == "" // not in forks
+	return deletesBranch, repo.SquashMergeCommitTitle != ""
+}
+
+// externalMerge triggers the merge bot (e.g. Mergify or bors) on the PR with git-pr.merge-label or
+// git-pr.merge-comment, then waits for the bot to merge it, and returns the merge commit on the main branch. The bot
+// may take a while, as it usually runs the checks again on top of the main branch: it waits up to -checks-timeout.
+func externalMerge(number int) string {
+	if config.MergeLabel != "" {
+		fmt.Printf("label #%v with %q for the merge bot\n", number, config.MergeLabel)
+		must(0, forge.AddLabels(number, config.MergeLabel))
+	}
+	if config.MergeComment != "" {
+		fmt.Printf("comment %q on #%v for the merge bot\n", config.MergeComment, number)
+		must(0, githubCreateComment(number, config.MergeComment))
+	}
+	fmt.Printf("waiting for the merge bot to merge #%v...\n", number)
+	var pr *PR
+	merged, err := pollUntil(config.ChecksTimeout, pollBackoff(config.PollInterval, time.Minute), func() (bool, error) {
+		var err error
+		if pr, err = forge.GetPR(number); err != nil {
+			return false, err
+		}
+		if pr.MergedAt == nil && pr.State != "merged" && pr.State != "open" {
+			return false, errorf("#%v was closed without merging, check the merge bot at %v", number, forge.PRURL(number))
+		}
+		return pr.MergedAt != nil || pr.State == "merged", nil
+	})
+	must(0, err)
+	if !merged {
+		exitf("#%v was not merged in %v, check the merge bot at %v", number, config.ChecksTimeout, forge.PRURL(number))
+	}
+	if pr.MergeCommitSHA == "" {
+		exitf("#%v was merged, but %v does not tell its merge commit", number, forgeDisplayName(config.Forge))
+	}
+	return pr.MergeCommitSHA
+}
+
+// LandedPR maps a PR landed by squash-land to its commit on the main branch, kept in .git/git-pr/landed.json for
+// traceability.
+type LandedPR struct {
+	PRNumber  int       `json:"pr"`
+	Title     string    `json:"title"`
+	Hash      string    `json:"hash"` // the local commit
+	RemoteRef string    `json:"remote_ref,omitempty"`
+	Stack     string    `json:"stack,omitempty"` // from the "Stack:" trailer
+	TrunkSHA  string    `json:"trunk_sha"`       // the squash commit on the main branch
+	Verified  *bool     `json:"verified,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+func landedPRsPath() string {
+	return filepath.Join(gitPRDir(), "landed.json")
+}
+
+// loadLandedPRs reads the PRs landed from this repository, in the order they landed.
+func loadLandedPRs() (list []*LandedPR) {
+	if data, err := os.ReadFile(landedPRsPath()); err == nil {
+		_ = json.Unmarshal(data, &list)
+	}
+	return list
+}
+
+func recordLandedPR(landed *LandedPR) {
+	list := append(loadLandedPRs(), landed)
+	if err := os.WriteFile(landedPRsPath(), must(json.MarshalIndent(list, "", "  ")), 0644); err != nil {
+		debugf("failed to save the landed PRs (ignored): %v\n", err)
+	}
+}
+
+// verifyLandedCommit checks the squash commit on the main branch, with git config git-pr.verify-land: it must be
+// fetched on the main branch, signed by GitHub (committed by web-flow), and authored by the user.
+func verifyLandedCommit(commit *Commit, mergedSHA, originMain string) (problems []string) {
+	if !isAncestor(mergedSHA, originMain) {
+		problems = append(problems, fmt.Sprintf("%v is not on %v", shortHash(mergedSHA), originMain))
+	}
+	landed := must(githubGetCommit(mergedSHA))
+	if v := landed.Commit.Verification; !v.Verified {
+		problems = append(problems, fmt.Sprintf("the signature is not verified (%v)", strings.ReplaceAll(v.Reason, "_", " ")))
+	}
+	if landed.Committer == nil || landed.Committer.Login != "web-flow" {
+		problems = append(problems, "not committed by GitHub (web-flow)")
+	}
+	// GitHub may author it with another email of the user, e.g. the noreply address
+	if email := landed.Commit.Author.Email; !strings.EqualFold(email, commit.AuthorEmail) && !isMyOwnCommit(&Commit{AuthorEmail: email}) {
+		problems = append(problems, fmt.Sprintf("authored by %v instead of %v", landed.Commit.Author.Email, commit.AuthorEmail))
+	}
+	return problems
+}
+
+// checkLandedPatch compares the changes landed on the main branch with the local commit, by "git patch-id", and
+// returns the problem when they differ: e.g. from a conflict resolution on GitHub, or commits pushed to the PR by
+// someone else, which were not reviewed locally.
+func checkLandedPatch(commit *Commit, mergedSHA, headSHA string) string {
+	landedID, localID := patchID(mergedSHA), patchID(commit.Hash)
+	if landedID == localID {
+		return ""
+	}
+	problem := fmt.Sprintf("the changes differ from the local commit %v", commit.ShortHash())
+	if !strings.HasPrefix(headSHA, commit.Hash) && patchID(headSHA) != localID {
+		problem += fmt.Sprintf(" (the PR was at %v)", shortHash(headSHA))
+	}
+	landed, local := shortHash(mergedSHA), commit.ShortHash()
+	return problem + fmt.Sprintf(`: compare them with "git range-diff %v^..%v %v^..%v"`, landed, landed, local, local)
+}
+
+// patchID returns the "git patch-id" of the changes of the commit from its first parent, or "" when it has no changes
+// or is not fetched.
+func patchID(hash string) string {
+	diff, err := execGit("diff", "--no-color", "--no-ext-diff", hash+"^", hash)
+	if err != nil {
+		return ""
+	}
+	out, _ := execCommandWithInput(diff, "git", "patch-id", "--stable")
+	id, _, _ := strings.Cut(out, " ")
+	return id
+}
+
+// signatureHint tells how to fix the signature verification with the reason from GitHub.
+func signatureHint(reason string) string {
+	switch reason {
+	case "unsigned":
+		return `sign the commit with "git commit --amend --no-edit -S" (set "git config commit.gpgsign true" to always sign), then run "git pr squash-land" again`
+	case "unknown_key", "no_user", "unverified_email", "bad_email":
+		return "add the signing key to your GitHub account, with a verified email matching the committer email, then sign the commit again"
+	default:
+		return "see https://docs.github.com/en/authentication/managing-commit-signature-verification"
+	}
+}
+
+// waitForChecks waits until all check runs of the commit complete, printing the progress, and returns the names of
+// the failed ones. It exits when the checks don't complete within -checks-timeout.
+//
+// When since is set, the checks are expected to run again (e.g. after changing the base of the PR): the runs completed
+// before are ignored for a grace period, until the new runs show up.
+func waitForChecks(sha string, since time.Time) (failed []string) {
+	const grace = 2 * time.Minute
+	usual := checkDurations()
+	start := time.Now()
+	lastSummary := ""
+	done, err := pollUntil(config.ChecksTimeout+xif(since.IsZero(), 0, grace), pollBackoff(config.PollInterval, time.Minute), func() (bool, error) {
+		runs, err := forge.ListChecks(sha)
+		if err != nil {
+			return false, err
+		}
+		runs = latestCheckRuns(runs)
+		if len(runs) == 0 {
+			// the checks may not be created yet, or the repository has none
+			return time.Since(start) > time.Minute, nil
+		}
+		if !since.IsZero() && time.Since(since) < grace && !hasCheckRunsSince(runs, since) {
+			return false, nil // the checks have not restarted yet
+		}
+		if summary := summarizeChecks(runs, usual, time.Now()); summary != lastSummary {
+			fmt.Printf("  %v\n", summary)
+			lastSummary = summary
+		}
+		failed = failed[:0]
+		for _, run := range runs {
+			if run.Status != "completed" {
+				return false, nil
+			}
+			if !isCheckPassed(run) {
+				failed = append(failed, run.Name)
+			}
+		}
+		return true, nil
+	})
+	must(0, err)
+	if !done {
+		exitCodef(ExitChecksFailed, "checks of %v did not complete in %v", shortHash(sha), config.ChecksTimeout)
+	}
+	return failed
+}
+
+func isCheckPassed(run CheckRun) bool {
+	return run.Conclusion == "success" || run.Conclusion == "neutral" || run.Conclusion == "skipped"
+}
+
+// planSquashLand prints the actions which squash-land would take with the current state on GitHub, and the blockers
+// which would stop it, without changing anything.
+func planSquashLand(commit *Commit) {
+	var steps, blockers []string
+	remoteRef := commit.GetRemoteRef()
+	number := 0
+	if remoteRef != "" {
+		number = must(githubGetPRNumberByHead(remoteRef))
+	}
+	pushed := false
+	if remoteRef != "" {
+		remoteHashes := must(getRemoteHashes(config.PushRemote, []string{remoteRef}))
+		pushed = remoteHashes[remoteRef] == commit.Hash
+	}
+	switch {
+	case !pushed:
+		steps = append(steps, fmt.Sprintf("push %v to %v", commit.ShortHash(), coalesce(remoteRef, "a new branch")))
+	default:
+		steps = append(steps, fmt.Sprintf("%v is up-to-date", remoteRef))
+	}
+	steps = append(steps, xif(number == 0, "create the pull request", fmt.Sprintf("update #%v", number)))
+
+	if isHeld(commit) {
+		blockers = append(blockers, "on hold")
+	}
+	if unmerged := formatDependencies(loadDependencies(commit)); unmerged != "" {
+		blockers = append(blockers, "depends on unmerged "+unmerged)
+	}
+	if number == 0 {
+		required := must(githubGetRequiredReviews(config.MainBranch))
+		if required.Approvals > 0 {
+			blockers = append(blockers, fmt.Sprintf("needs %v %v on the new PR", required.Approvals, xif(required.Approvals == 1, "approval", "approvals")))
+		}
+	} else {
+		status := loadStackStatus([]*Commit{commit})[0]
+		status.RequiredApprovals = must(githubGetRequiredReviews(config.MainBranch)).Approvals
+		if pending := status.PendingReviews(); pending != "" {
+			blockers = append(blockers, pending)
+		}
+		if requesters := status.ChangesRequestedBy(); len(requesters) > 0 {
+			blockers = append(blockers, "changes requested by "+strings.Join(requesters, ", "))
+		}
+	}
+
+	repo := must(githubGetRepo(config.Repo))
+	conflicts, warnings := landProtectionConflicts(repo, must(githubGetBranchRules(config.MainBranch)), must(githubGetBranchProtection(config.MainBranch)))
+	blockers = append(blockers, conflicts...)
+	if number != 0 {
+		// "blocked" is already explained by the reviews and protections above, when they are the reason
+		if state := must(githubGetPRStates([]int{number}))[number]; state != nil {
+			if desc := describeMergeState(state); desc != "" && (state.MergeStateStatus != "BLOCKED" || len(blockers) == 0) {
+				blockers = append(blockers, desc)
+			}
+		}
+	}
+	if must(githubRequiresSignatures(config.MainBranch)) {
+		if pushed {
+			if v := must(githubGetCommitVerification(commit.Hash)); !v.Verified {
+				blockers = append(blockers, fmt.Sprintf("signature not verified (%v), required by %v", strings.ReplaceAll(v.Reason, "_", " "), config.MainBranch))
+			}
+		} else if strings.TrimSpace(must(execGit("log", "-1", "--format=%G?", commit.Hash))) == "N" {
+			blockers = append(blockers, fmt.Sprintf("not signed, signatures are required by %v", config.MainBranch))
+		}
+	}
+
+	if pushed {
+		runs := latestCheckRuns(must(githubListCheckRuns(commit.Hash)))
+		var failed []string
+		for _, run := range runs {
+			if run.Status == "completed" && !isCheckPassed(run) {
+				failed = append(failed, run.Name)
+			}
+		}
+		if len(failed) > 0 {
+			blockers = append(blockers, "checks failed: "+strings.Join(failed, ", "))
+		} else if summary := summarizeChecks(runs, checkDurations(), time.Now()); summary != "" {
+			steps = append(steps, "wait for the checks ("+summary+")")
+		}
+	} else {
+		steps = append(steps, "wait for the checks to run on the new commit")
+	}
+	prName := xif(number == 0, "the PR", fmt.Sprintf("#%v", number))
+	if config.ExternalMerge {
+		if config.MergeLabel != "" {
+			steps = append(steps, fmt.Sprintf("label %v with %q", prName, config.MergeLabel))
+		}
+		if config.MergeComment != "" {
+			steps = append(steps, fmt.Sprintf("comment %q on %v", config.MergeComment, prName))
+		}
+		steps = append(steps, fmt.Sprintf("wait for the merge bot to merge %v into %v", prName, config.MainBranch))
+	} else {
+		steps = append(steps, fmt.Sprintf("squash-merge %v into %v", prName, config.MainBranch))
+	}
+	deletesBranch, _ := githubMergeSettings(repo)
+	steps = append(steps, xif(config.KeepBranches || deletesBranch, "", "delete the branch and ")+"check out "+config.MainBranch)
+
+	fmt.Printf("squash-land would:\n")
+	for i, step := range steps {
+		fmt.Printf("  %v. %v\n", i+1, step)
+	}
+	if len(warnings) > 0 {
+		fmt.Println()
+	}
+	for _, warning := range warnings {
+		fmt.Printf("⚠️  %v\n", warning)
+	}
+	if len(blockers) == 0 {
+		fmt.Println("\nno blockers found")
+		return
+	}
+	fmt.Printf("\nit would be blocked by:\n")
+	for _, blocker := range blockers {
+		fmt.Printf("  - %v\n", blocker)
+	}
+}
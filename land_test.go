@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestSquashMessage(t *testing.T) {
+	commit := &Commit{
+		AuthorEmail: "me@example.com",
+		Title:       "Fix the parser",
+		Message:     "It failed on empty lines.\n",
+		Attrs: []KeyVal{
+			{KeyCoAuthoredBy, "Ann <ann@example.com>"},
+			{KeyReverts, "#12"},
+			{KeyRemoteRef, "me/pr/parser"},
+			{KeyStack, "parser"},
+		},
+	}
+	want := `Fix the parser (#34)
+
+It failed on empty lines.
+
+Co-authored-by: Ann <ann@example.com>
+Reverts: #12`
+	if got := squashMessage(commit, "Fix the parser (#34)", 34); got != want {
+		t.Errorf("squashMessage() =\n%v\nwant\n%v", got, want)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// messageCatalog translates the generated parts of the PR body, with git config git-pr.locale. The keys are the
+// English messages, which are used when the locale or the message is missing. The format verbs use explicit indexes
+// when the translation reorders them.
+var messageCatalog = map[string]map[string]string{
+	"de": {
+		"Summary":                          "Zusammenfassung",
+		"Generated description":            "Erzeugte Beschreibung",
+		"Scope":                            "Umfang",
+		"%v files changed (+%v -%v) in %v": "%v Dateien geändert (+%v -%v) in %v",
+		"Test plan":                        "Testplan",
+		"Submodules only":                  "Nur Submodule",
+		"Co-review":                        "Co-Review",
+	},
+	"es": {
+		"Summary":                          "Resumen",
+		"Generated description":            "Descripción generada",
+		"Scope":                            "Alcance",
+		"%v files changed (+%v -%v) in %v": "%v archivos modificados (+%v -%v) en %v",
+		"Test plan":                        "Plan de pruebas",
+		"Submodules only":                  "Solo submódulos",
+		"Co-review":                        "Co-revisión",
+	},
+	"fr": {
+		"Summary":                          "Résumé",
+		"Generated description":            "Description générée",
+		"Scope":                            "Portée",
+		"%v files changed (+%v -%v) in %v": "%v fichiers modifiés (+%v -%v) dans %v",
+		"Test plan":                        "Plan de test",
+		"Submodules only":                  "Sous-modules uniquement",
+		"Co-review":                        "Co-revue",
+	},
+	"ja": {
+		"Summary":                          "概要",
+		"Generated description":            "自動生成された説明",
+		"Scope":                            "範囲",
+		"%v files changed (+%v -%v) in %v": "%[4]v の %[1]v ファイルを変更 (+%[2]v -%[3]v)",
+		"Test plan":                        "テスト計画",
+		"Submodules only":                  "サブモジュールのみ",
+		"Co-review":                        "共同レビュー",
+	},
+	"pt": {
+		"Summary":                          "Resumo",
+		"Generated description":            "Descrição gerada",
+		"Scope":                            "Escopo",
+		"%v files changed (+%v -%v) in %v": "%v arquivos alterados (+%v -%v) em %v",
+		"Test plan":                        "Plano de teste",
+		"Submodules only":                  "Somente submódulos",
+		"Co-review":                        "Co-revisão",
+	},
+	"vi": {
+		"Summary":                          "Tóm tắt",
+		"Generated description":            "Mô tả được tạo tự động",
+		"Scope":                            "Phạm vi",
+		"%v files changed (+%v -%v) in %v": "%v tệp thay đổi (+%v -%v) trong %v",
+		"Test plan":                        "Kế hoạch kiểm thử",
+		"Submodules only":                  "Chỉ submodule",
+		"Co-review":                        "Đồng review",
+	},
+}
+
+// localize returns the message in the language of git config git-pr.locale, or the message itself when there is no
+// translation.
+func localize(msg string) string {
+	if translated := messageCatalog[config.Locale][msg]; translated != "" {
+		return translated
+	}
+	return msg
+}
+
+// parseLocale returns the catalog key of the locale ("pt-BR" and "pt_BR.UTF-8" are "pt"), "" for English, or false
+// when there is no catalog for it.
+func parseLocale(locale string) (string, bool) {
+	lang := strings.ToLower(strings.TrimSpace(locale))
+	if i := strings.IndexAny(lang, "-_.@"); i >= 0 {
+		lang = lang[:i]
+	}
+	if lang == "" || lang == "en" {
+		return "", true
+	}
+	if _, ok := messageCatalog[lang]; ok {
+		return lang, true
+	}
+	return "", false
+}
+
+// availableLocales lists the locales of the catalog, for the error message.
+func availableLocales() []string {
+	locales := []string{"en"}
+	for locale := range messageCatalog {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales[1:])
+	return locales
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestMessageCatalog(t *testing.T) {
+	verbs := regexp.MustCompile(`%(\[\d+\])?v`)
+	for locale, messages := range messageCatalog {
+		for msg, translated := range messages {
+			if got, want := len(verbs.FindAllString(translated, -1)), strings.Count(msg, "%v"); got != want {
+				t.Errorf("%v: %q has %v verbs, want %v", locale, translated, got, want)
+			}
+		}
+	}
+}
+
+func TestParseLocale(t *testing.T) {
+	tests := map[string]string{"fr": "fr", "pt-BR": "pt", "ja_JP.UTF-8": "ja", "EN": "", "en_US": "", "xx": "!"}
+	for input, want := range tests {
+		got, ok := parseLocale(input)
+		if !ok {
+			got = "!"
+		}
+		if got != want {
+			t.Errorf("parseLocale(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
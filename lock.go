@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readOnlyCommands only read the stack and the PRs: they run without the lock, e.g. "git pr status" while submitting.
+var readOnlyCommands = []string{"status", "prs", "stats", "version", "annotate", "review"}
+
+// acquireLock prevents concurrent git-pr runs in the same worktree from racing each other and creating duplicated
+// PRs. Each worktree has its own stack, so the lock is in its own git dir, and the other worktrees are not blocked.
+// The lock file contains the pid of the running process, so a lock left behind by a crashed run is detected and
+// removed. The read-only commands don't take it.
+func acquireLock() (release func()) {
+	if containsString(readOnlyCommands, config.Command) {
+		return func() {}
+	}
+	lockPath := repoPath(strings.TrimSpace(must(execGit("rev-parse", "--git-path", "git-pr.lock"))))
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			fprint(f, os.Getpid())
+			must(0, f.Close())
+			return func() { _ = os.Remove(lockPath) }
+		}
+		if !os.IsExist(err) {
+			panicf(err, "failed to create lock file %v", lockPath)
+		}
+
+		data, _ := os.ReadFile(lockPath)
+		pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+		if pid > 0 && processExists(pid) {
+			exitf("another git-pr is running in this worktree (pid %v)\n\nHint: wait for it to finish, or remove %v if it is stuck", pid, lockPath)
+		}
+		debugf("remove stale lock file %v (pid %v)\n", lockPath, pid)
+		_ = os.Remove(lockPath)
+	}
+}
@@ -0,0 +1,25 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+const stillActive = 259 // the exit code of a running process
+
+// processExists checks whether the process of a lock file is still running. Windows has no null signal: open the
+// process and check that it has not exited yet.
+func processExists(pid int) bool {
+	h, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return errors.Is(err, syscall.ERROR_ACCESS_DENIED) // running as another user
+	}
+	defer syscall.CloseHandle(h)
+	var code uint32
+	if err = syscall.GetExitCodeProcess(h, &code); err != nil {
+		return false
+	}
+	return code == stillActive
+}
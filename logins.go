@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	loginCache   map[string]string // email -> login, "" when not found
+	loginCacheMu sync.Mutex
+)
+
+func loginCachePath() string {
+	return filepath.Join(gitPRDir(), "logins.json")
+}
+
+// resolveLogin returns the GitHub login of the commit author email, from git config git-pr.login, the cache in
+// .git/git-pr/logins.json, or the commit search API. It returns "" when not found or with git-pr.resolve-logins=false.
+func resolveLogin(email string) string {
+	if login := config.Logins[strings.ToLower(email)]; login != "" {
+		return login
+	}
+	if !config.ResolveLogins || email == "" {
+		return ""
+	}
+	loginCacheMu.Lock()
+	defer loginCacheMu.Unlock()
+	if loginCache == nil {
+		loginCache = map[string]string{}
+		if data, err := os.ReadFile(loginCachePath()); err == nil {
+			_ = json.Unmarshal(data, &loginCache)
+		}
+	}
+	if login, ok := loginCache[email]; ok {
+		return login
+	}
+	login, err := githubSearchLoginByEmail(email)
+	if err != nil {
+		debugf("failed to resolve the login of %v (ignored): %v\n", email, err)
+		return "" // try again next time
+	}
+	loginCache[email] = login
+	if err = os.WriteFile(loginCachePath(), must(json.MarshalIndent(loginCache, "", "  ")), 0644); err != nil {
+		debugf("failed to save the logins (ignored): %v\n", err)
+	}
+	return login
+}
+
+// githubSearchLoginByEmail finds the login of the author of any commit with the email, or returns "" if none is
+// linked to a GitHub account.
+func githubSearchLoginByEmail(email string) (string, error) {
+	ghURL := fmt.Sprintf("https://api.%v/search/commits?per_page=1&q=%v", config.Host, url.QueryEscape("author-email:"+email))
+	jsonBody, err := httpGET(ghURL)
+	if err != nil {
+		return "", err
+	}
+	var out struct {
+		Items []struct {
+			Author *struct {
+				Login string `json:"login"`
+			} `json:"author"`
+		} `json:"items"`
+	}
+	if err = json.Unmarshal(jsonBody, &out); err != nil {
+		return "", errorf("failed to parse request body: %v", err)
+	}
+	if len(out.Items) == 0 || out.Items[0].Author == nil {
+		return "", nil
+	}
+	return out.Items[0].Author.Login, nil
+}
+
+// formatAuthor shows the login of the author, or the email when unknown. The separator (a zero-width space) is
+// inserted to not mention the user nor create an email link.
+func formatAuthor(email, separator string) string {
+	if login := resolveLogin(email); login != "" {
+		return "@" + separator + login
+	}
+	first, last := splitEmail(email)
+	return first + separator + last
+}
@@ -6,7 +6,6 @@ package main
 
 import (
 	"fmt"
-	"os"
 	"regexp"
 	"strconv"
 	"strings"
@@ -15,45 +14,141 @@ import (
 )
 
 const (
-	KeyTags      = "tags"
-	KeyRemoteRef = "remote-ref"
-	head         = "HEAD"
+	KeyTags         = "tags"
+	KeyRemoteRef    = "remote-ref"
+	KeyReverts      = "reverts"
+	KeyStack        = "stack"
+	KeyDependsOn    = "depends-on"
+	KeyCoReview     = "co-review"
+	KeyHold         = "hold"
+	KeyTestPlan     = "test-plan"
+	KeyCoAuthoredBy = "co-authored-by"
+	head            = "HEAD"
 )
 
-const bodyTemplate = `
-# Summary
+var regexpDraft = regexp.MustCompile(`(?i)\[draft]`)
 
-<br>
-<br>
-<br>
-<br>
-`
+const (
+	refFormatHash  = "hash"
+	refFormatStack = "stack"
+)
 
-var regexpDraft = regexp.MustCompile(`(?i)\[draft]`)
+const (
+	othersPRsUpdate = "update"
+	othersPRsKeep   = "keep"
+)
 
 // select emojis
 
 func main() {
+	defer handleErrors()
 	config = LoadConfig()
+	switch config.Forge {
+	case forgeGitLab:
+		forge = gitlabForge{}
+	case forgeBitbucket:
+		forge = bitbucketForge{}
+	case forgeGitea:
+		forge = giteaForge{}
+	}
+	if config.Forge != forgeGitHub && containsString(githubOnlyCommands, config.Command) {
+		exitCodef(ExitConfig, "%q is only supported on GitHub", config.Command)
+	}
+	defer runExitHooks()
+	onExit(acquireLock())
+	onExit(recordAPIStats)
+	if config.Command != "version" {
+		ensureCompatibleTools()
+	}
+	ensureFullHistory()
+	if config.Stack != "" {
+		checkoutStack(config.Stack)
+	}
 
-	// ensure no uncommitted changes
-	if !validateGitStatusClean() {
-		fmt.Println(`"git status reports uncommitted changes"`)
-		fmt.Print(`
-Hint: use "git add -A" and "git stash" to clean up the repository
-`)
-		os.Exit(1)
+	switch config.Command {
+	case "":
+		submitStack()
+	case "continue":
+		continueSubmit(config.Args)
+	case "transfer":
+		transferStack(config.Args)
+	case "revert":
+		revertPRs(config.Args)
+	case "review":
+		reviewStack(config.Args)
+	case "amend":
+		amendCommit(config.Args)
+	case "absorb":
+		absorbChanges(config.Args)
+	case "status":
+		statusStack(config.Args)
+	case "prs":
+		listStackPRs(config.Args)
+	case "sync":
+		syncStacks(config.Args)
+	case "hold":
+		holdCommit(config.Args, true)
+	case "unhold":
+		holdCommit(config.Args, false)
+	case "workspace":
+		workspaceCommand(config.Args)
+	case "adopt-branch":
+		adoptBranch(config.Args)
+	case "stats":
+		showAPIStats(config.Args)
+	case "squash-land":
+		squashLand(config.Args)
+	case "state":
+		stateCommand(config.Args)
+	case "annotate":
+		annotateTrunk(config.Args)
+	case "version":
+		showVersion(config.Args)
+	default:
+		exitCodef(ExitConfig, "unknown command %q", config.Command)
 	}
+}
+
+func submitStack() {
+	// ensure no uncommitted changes
+	ensureGitStatusClean()
 
 	originMain := fmt.Sprintf("%v/%v", config.Remote, config.MainBranch)
-	stackedCommits := must(getStackedCommits(originMain, head))
+	must(execGitRemote(config.Remote, "fetch", config.Remote, config.MainBranch)) // to detect the commits landed from another machine
+	checkGitHubHealth()
+	flattenMergeCommits(originMain)
+	// with -until, only the bottom of the stack is submitted: it's counted rather than kept by hash, as the commits are
+	// rewritten below
+	untilCount := countCommitsUntil(originMain)
+	getStack := func() []*Commit {
+		commits := must(getStackedCommits(originMain, head))
+		if untilCount > 0 && untilCount < len(commits) {
+			commits = commits[:untilCount]
+		}
+		return commits
+	}
+	stackedCommits := getStack()
 	if len(stackedCommits) == 0 {
 		exitf("no commits to submit")
 	}
+	run := &submitRun{Until: config.Until, BaseRev: config.BaseRev, Started: time.Now()}
+	saveSubmitRun(run)
+	if baseHash := resolveBaseRev(originMain); baseHash != "" {
+		rebaseOntoBaseRev(originMain, baseHash)
+		stackedCommits = getStack()
+	}
+	if config.Forge == forgeGitHub {
+		setupPushRemote()
+	}
 	for _, commit := range stackedCommits {
 		fmt.Println(commit)
 	}
 	fmt.Println()
+	if config.Forge == forgeGitHub {
+		checkRevertedCommits(stackedCommits)
+	}
+	checkCommitSizes(stackedCommits)
+	checkTestPlans(stackedCommits)
 
 	// validate no duplicated remote ref
 	mapRefs := map[string]*Commit{}
@@ -63,20 +158,31 @@ Hint: use "git add -A" and "git stash" to clean up the repository
 			continue
 		}
 		if last, ok := mapRefs[remoteRef]; ok {
-			exitf("duplicated remote ref %q found for %q and %q", last.GetRemoteRef(), last.ShortHash(), commit.ShortHash())
+			exitCodef(ExitConfig, "duplicated remote ref %q found for %q and %q", last.GetRemoteRef(), last.ShortHash(), commit.ShortHash())
 		}
 		mapRefs[remoteRef] = commit
 	}
 
+	// check the repository settings before creating the PRs of a new stack
+	if len(mapRefs) == 0 && config.Forge == forgeGitHub {
+		checkRepoCompatibility(newRemoteRef(stackedCommits[0], stackedCommits))
+	}
+
 	// fill remote ref for each commit
 	for commitWithoutRemoteRef := findCommitWithoutRemoteRef(stackedCommits); commitWithoutRemoteRef != nil; commitWithoutRemoteRef = findCommitWithoutRemoteRef(stackedCommits) {
-		remoteRef := fmt.Sprintf("%v/%v", config.User, commitWithoutRemoteRef.ShortHash())
+		remoteRef := newRemoteRef(commitWithoutRemoteRef, stackedCommits)
 		commitWithoutRemoteRef.SetAttr(KeyRemoteRef, remoteRef)
 		debugf("creating remote ref %v for %v", remoteRef, commitWithoutRemoteRef.Title)
 		must(execGit("reword", commitWithoutRemoteRef.Hash, "-m", commitWithoutRemoteRef.FullMessage()))
 
 		time.Sleep(500 * time.Millisecond)
-		stackedCommits = must(getStackedCommits(originMain, head))
+		stackedCommits = getStack()
+	}
+	skipLandedCommits(stackedCommits)
+	// the commits to push: the local ones, or their replay onto the main branch when the commits below landed
+	replayed := rebaseAboveLanded(stackedCommits, originMain)
+	pushHash := func(commit *Commit) string {
+		return coalesce(replayed[commit.Hash], commit.Hash)
 	}
 
 	prevCommit := func(commit *Commit) (prev *Commit) {
@@ -92,21 +198,46 @@ Hint: use "git add -A" and "git stash" to clean up the repository
 		panic("not found")
 	}
 	pushCommit := func(commit *Commit) (logs string, execFunc func()) {
-		args := fmt.Sprintf("%v:refs/heads/%v", commit.ShortHash(), commit.GetAttr(KeyRemoteRef))
-		logs = fmt.Sprintf("push -f %v %v", config.Remote, args)
+		args := fmt.Sprintf("%v:refs/heads/%v", pushHash(commit)[:8], commit.GetAttr(KeyRemoteRef))
+		logs = fmt.Sprintf("push -f %v %v", config.PushRemote, args)
+		pushArgs := []string{"push", "-f", config.PushRemote, args}
+		if stats := must(getCommitStats(commit.Hash)); len(stats.Submodules) > 0 {
+			// refuse to push when the submodule commits are not on their remote, CI could not check them out
+			pushArgs = append(pushArgs, "--recurse-submodules=check")
+		}
 		return logs, func() {
-			out := must(execGit("push", "-f", config.Remote, args))
-			if strings.Contains(out, "remote: Create a pull request") {
-				must(0, githubCreatePRForCommit(commit, prevCommit(commit)))
+			defer recordSubmitError(commit)
+			out := must(execGitRemote(config.PushRemote, pushArgs...))
+			setSubmitResult(commit, func(result *SubmitResult) { result.Pushed, result.Step = pushHash(commit), submitStepPushed })
+			if strings.Contains(out, "remote: Create a pull request") || strings.Contains(out, "remote: To create a merge request") ||
+				strings.Contains(out, "remote: Create pull request for") || strings.Contains(out, "remote: Create a new pull request for") {
+				must(0, forge.CreatePR(commit, prevCommit(commit)))
+				setSubmitResult(commit, func(result *SubmitResult) { result.PRNumber, result.Step = commit.PRNumber, submitStepPR })
 			} else {
-				must(0, githubPRUpdateBaseForCommit(commit, prevCommit(commit)))
+				must(0, forge.UpdateBase(commit, prevCommit(commit)))
 			}
 		}
 	}
 	// push commits, concurrently
+	var pushedCommits []*Commit
 	{
-		var wg sync.WaitGroup
+		var remoteRefs []string
 		for _, commit := range stackedCommits {
+			remoteRefs = append(remoteRefs, commit.GetRemoteRef())
+		}
+		remoteHashes := must(getRemoteHashes(config.PushRemote, remoteRefs))
+
+		var commitsToPush []*Commit
+		for _, commit := range stackedCommits {
+			if commit.Skip {
+				continue // already landed
+			}
+			// never push commits managed by other stacking tools
+			if tool := foreignStackToolOfCommit(commit); tool != "" {
+				commit.Skip = true
+				fmt.Printf("skip \"%v\" (managed by %v)\n", shortenTitle(commit.Title), tool)
+				continue
+			}
 			// push my own commits
 			// and include others' commits if "--include-other-authors" is set
 			shouldPush := isMyOwnCommit(commit) || config.IncludeOtherAuthors
@@ -116,33 +247,72 @@ Hint: use "git add -A" and "git stash" to clean up the repository
 				fmt.Printf("skip \"%v\" (%v)\n", shortenTitle(commit.Title), author)
 				continue
 			}
+			// only push commits which changed since the last push
+			if remoteHashes[commit.GetRemoteRef()] == pushHash(commit) {
+				fmt.Printf("up-to-date %v\n", commit.GetRemoteRef())
+				continue
+			}
+			commitsToPush = append(commitsToPush, commit)
+		}
+		// force-pushing restarts the checks: don't push when only the commit messages changed, the PRs are updated
+		// through the API. A partial push would break the stack, as the commits above would not be on top of the
+		// branches below anymore.
+		metadataOnly := len(commitsToPush) > 0
+		for _, commit := range commitsToPush {
+			metadataOnly = metadataOnly && isSameChange(remoteHashes[commit.GetRemoteRef()], pushHash(commit))
+		}
+		if metadataOnly {
+			for _, commit := range commitsToPush {
+				fmt.Printf("keep %v (only the commit message changed)\n", commit.GetRemoteRef())
+			}
+			commitsToPush = nil
+		}
+		checkSecrets(commitsToPush)
+		beginSubmitResults(stackedCommits)
+		for _, commit := range stackedCommits {
+			if remoteHash := remoteHashes[commit.GetRemoteRef()]; remoteHash != "" {
+				setSubmitResult(commit, func(result *SubmitResult) {
+					result.Pushed = remoteHash
+					if remoteHash == pushHash(commit) {
+						result.Step = submitStepPushed
+					}
+				})
+			}
+		}
+
+		var wg sync.WaitGroup
+		for _, commit := range commitsToPush {
 			wg.Add(1)
 			logs, execFunc := pushCommit(commit)
 			fmt.Println(logs)
 			go func() {
 				defer wg.Done()
+				defer forwardErrors()
 				execFunc()
 			}()
 		}
-		wg.Wait()
+		waitGoroutines(&wg)
+		pushedCommits = commitsToPush
 	}
 
-	// checkout the latest stacked commit
-	must(execGit("checkout", stackedCommits[len(stackedCommits)-1].Hash))
+	// checkout the latest stacked commit, or stay at the top of the stack with -until
+	if untilCount == 0 {
+		must(execGit("checkout", stackedCommits[len(stackedCommits)-1].Hash))
+	}
 
-	// wait for 5 seconds
-	fmt.Printf("waiting a bit...\n")
-	time.Sleep(5 * time.Second)
+	waitForPropagation(pushedCommits, pushHash)
 
 	// update commits with PR numbers, concurrently
 	{
 		var wg sync.WaitGroup
 		for i := len(stackedCommits) - 1; i >= 0; i-- {
-			commit := stackedCommits[i]
+			i, commit := i, stackedCommits[i]
 			if commit.PRNumber == 0 {
 				wg.Add(1)
 				go func() {
 					defer wg.Done()
+					defer forwardErrors()
+					defer recordSubmitError(commit)
 					var prev *Commit
 					for j := 0; j < i; j++ {
 						cm := stackedCommits[j]
@@ -151,15 +321,21 @@ Hint: use "git add -A" and "git stash" to clean up the repository
 							break
 						}
 					}
-					commit.PRNumber = must(githubGetPRNumberForCommit(commit, prev))
+					commit.PRNumber = must(forge.GetPRNumber(commit, prev))
+					setSubmitResult(commit, func(result *SubmitResult) { result.PRNumber, result.Step = commit.PRNumber, submitStepPR })
 				}()
 			}
 		}
-		wg.Wait()
+		waitGoroutines(&wg)
+	}
+	var statuses []*PRStatus
+	if config.Forge == forgeGitHub {
+		statuses = loadStackStatus(stackedCommits) // before updating the PRs, which resets their activity
 	}
 
 	// update PRs with review link, concurrently
 	{
+		milestone := resolveMilestone()
 		var wg sync.WaitGroup
 		for _, commit := range stackedCommits {
 			if commit.Skip {
@@ -167,97 +343,138 @@ Hint: use "git add -A" and "git stash" to clean up the repository
 			}
 			wg.Add(1)
 			commit := commit
-			prURL := fmt.Sprintf("https://%v/%v/pull/%v", config.Host, config.Repo, commit.PRNumber)
-			fmt.Printf("update pull request %v\n", prURL)
+			fmt.Printf("update pull request %v\n", forge.PRURL(commit.PRNumber))
 			go func() {
 				defer wg.Done()
-
-				pr := must(githubGetPRByNumber(commit.PRNumber))
-				pullURL := fmt.Sprintf("https://api.%v/repos/%v/pulls/%v", config.Host, config.Repo, commit.PRNumber)
-
-				parsedBody := func() string {
-					footerIndex := prDelimiterRegexp.FindStringIndex(pr.Body)
-					if len(footerIndex) > 0 {
-						startIdx := footerIndex[0]
-						return strings.TrimSpace(pr.Body[:startIdx])
-					}
-					return pr.Body
-				}()
-
-				// generate the PR's body:
-				// - if the user edited the body on github, keep the body (+ commit message)
-				// - if the user didn't edit the body, but set the commit message, keep the commit message
-				// - if the user didn't edit the body and didn't set the commit message, use the default template
-				var bodyB strings.Builder
-				prf := func(msg string, args ...any) { fprintf(&bodyB, msg, args...) }
-				prLine := func() { prf("---\n\n") }
-				prDelim := func() { prf("%v\n\n", prDelimiterToGenerated) }
-				prMessage := func() { prf("%v\n\n", commit.Message) }
-				if parsedBody != "" {
-					prf("%v\n\n\n\n\n\n\n\n", parsedBody)
-					prDelim()
-					prLine()
-					prMessage()
-				} else if commit.Message == "" {
-
-					prf("%v\n\n\n\n\n\n\n\n", bodyTemplate) // TODO: config template
-					prDelim()
-					prLine()
-					prMessage()
-				} else {
-					prDelim()
-					prMessage()
-					prLine()
+				defer forwardErrors()
+				defer recordSubmitError(commit)
+				submitted := func() {
+					setSubmitResult(commit, func(result *SubmitResult) {
+						now := time.Now()
+						result.PRNumber, result.UpdatedAt, result.Error, result.Step = commit.PRNumber, &now, "", submitStepUpdated
+					})
 				}
 
-				// generate list of PRs:
-				// - for the current PR with an emoji, mark with an emoji and point to the commit
-				// - for other PRs, if it's from the author, use the PR number
-				// - otherwise, use the commit title and hash
-				for _, cm := range stackedCommits {
-					var cmRef string
-					cmURL := fmt.Sprintf("https://%v/%v/commit/%v", config.Host, config.Repo, cm.ShortHash())
-					switch {
-					case cm.PRNumber != 0 && cm.Hash == commit.Hash:
-						cmRef = fmt.Sprintf("#%v (👉[%v](%v))", cm.PRNumber, cm.ShortHash(), cmURL)
-					case cm.PRNumber != 0:
-						cmRef = fmt.Sprintf("#%v", cm.PRNumber)
-					default:
-						first, last := splitEmail(cm.AuthorEmail)
-						formattedEmail := first + "&#x200B;" + last // zero-width space to prevent creating email link
-						cmRef = fmt.Sprintf(`&nbsp;&nbsp;&nbsp;&nbsp;&nbsp;<b>[%v (%v)](%v)</b>&nbsp;&nbsp; ${\textsf{\color{lightblue}· %v}}$`, cm.Title, cm.ShortHash(), cmURL, formattedEmail)
-					}
-					if cm.Hash == commit.Hash {
-						prf("* " + emojisx[commit.PRNumber%len(emojisx)])
-					} else {
-						prf("* ◻️")
-					}
-					prf(" %v\n", cmRef)
+				pr := must(forge.GetPR(commit.PRNumber))
+				if tool := detectForeignStackTool(pr.Body); tool != "" {
+					fmt.Printf("keep the body of #%v (generated by %v)\n", commit.PRNumber, tool)
+					submitted()
+					return
+				}
+				if config.OthersPRs == othersPRsKeep && (!isMyOwnCommit(commit) || !strings.EqualFold(pr.User.Login, config.User)) {
+					fmt.Printf("keep #%v (%v)\n", commit.PRNumber, xif(isMyOwnCommit(commit), "opened by @"+pr.User.Login, coalesce(commit.AuthorEmail, "@unknown")))
+					submitted()
+					return
 				}
+				body := generatePRBody(commit, pr.Body, stackedCommits)
 
-				// update the PR
-				must(httpRequest("PATCH", pullURL, map[string]any{
-					"title": commit.Title,
-					"body":  bodyB.String(),
-				}))
-				isDraft := regexpDraft.MatchString(commit.Title)
-				if isDraft {
-					must(execGh("pr", "ready", strconv.Itoa(commit.PRNumber), "--undo"))
-				} else {
-					must(execGh("pr", "ready", strconv.Itoa(commit.PRNumber)))
+				// update the PR, only what changed to not notify reviewers for nothing
+				if pr.Title != commit.Title || pr.Body != body {
+					must(0, forge.UpdatePR(commit.PRNumber, commit.Title, body))
+				}
+				if labels := pr.MissingLabels(commit.GetTags(config.Tags...)); len(labels) > 0 {
+					must(0, forge.AddLabels(commit.PRNumber, labels...))
+				}
+				if config.Forge != forgeGitHub { // the draft state is from the title, and the rest is GitHub only
+					submitted()
+					return
+				}
+				if coReviews := getCoReviews(commit); len(coReviews) > 0 {
+					requestCoReviews(pr, coReviews)
 				}
-				if tags := commit.GetTags(config.Tags...); len(tags) > 0 {
-					must(execGh("pr", "edit", strconv.Itoa(commit.PRNumber), "--add-label", strings.Join(tags, ",")))
+				if milestone != nil && (pr.Milestone == nil || pr.Milestone.Number != milestone.Number) {
+					must(0, githubSetMilestone(commit.PRNumber, milestone.Number))
 				}
+				// last, as new PRs are created as drafts: the reviewers see them ready with everything set
+				if isDraft := regexpDraft.MatchString(commit.Title); isDraft != pr.Draft {
+					must(0, githubSetDraft(pr, isDraft))
+				}
+				submitted()
 			}()
 		}
-		wg.Wait()
+		waitGoroutines(&wg)
+		saveSubmitResults()
+	}
+	updateTrackingIssue(stackedCommits)
+	if config.DispatchWorkflow != "" {
+		dispatchStackWorkflow(stackedCommits)
+	}
+	run.Done = true
+	saveSubmitRun(run)
+
+	stats := make([]CommitStats, len(stackedCommits))
+	for i, commit := range stackedCommits {
+		stats[i] = must(getCommitStats(commit.Hash))
+	}
+	fmt.Printf("\n%v", formatSubmitSummary(stackedCommits, stats))
+	printStaleNudges(statuses)
+}
+
+// formatSubmitSummary lists the PRs of the stack from the bottom, with the size of their commits, to spot a commit
+// which took more changes than intended.
+func formatSubmitSummary(commits []*Commit, stats []CommitStats) string {
+	urls := make([]string, len(commits))
+	width := 0
+	for i, commit := range commits {
+		urls[i] = "-"
+		if commit.PRNumber != 0 {
+			urls[i] = forge.PRURL(commit.PRNumber)
+		}
+		width = xif(len(urls[i]) > width, len(urls[i]), width)
+	}
+	var b strings.Builder
+	for i, commit := range commits {
+		s := stats[i]
+		files := fmt.Sprintf("%v %v", s.Files, xif(s.Files == 1, "file", "files"))
+		fprintf(&b, "%-*v  %9v %7v %7v  %v\n", width, urls[i], files, fmt.Sprintf("+%v", s.Insertions), fmt.Sprintf("-%v", s.Deletions), shortenTitle(commit.Title))
+	}
+	return b.String()
+}
+
+// newRemoteRef generates the remote ref for a commit without one: "<user>/<hash>", or
+// "<user>/<stack-name>/<n>-<slug>" with git config git-pr.ref-format=stack.
+func newRemoteRef(commit *Commit, stackedCommits []*Commit) string {
+	if ref := ghstackHeadRef(commit); ref != "" {
+		return ref
+	}
+	if config.RefFormat != refFormatStack {
+		return fmt.Sprintf("%v/%v", config.User, commit.ShortHash())
+	}
+	// the stack name is from the "Stack:" trailer of any commit, or the title of the bottom commit
+	stackName := slugify(coalesce(getStackName(stackedCommits), stackedCommits[0].Title), 30)
+	index := 0
+	for i, cm := range stackedCommits {
+		if cm == commit {
+			index = i + 1
+		}
+	}
+	ref := fmt.Sprintf("%v/%v/%v-%v", config.User, stackName, index, slugify(commit.Title, 40))
+	for _, cm := range stackedCommits {
+		if cm.GetRemoteRef() == ref { // the stack was reordered
+			return ref + "-" + commit.ShortHash()
+		}
+	}
+	// never reuse the branch of a landed PR, when the branches are kept after landing
+	if remoteHashes := must(getRemoteHashes(config.PushRemote, []string{ref})); remoteHashes[ref] != "" {
+		return ref + "-" + commit.ShortHash()
 	}
+	return ref
+}
+
+var regexpNonSlug = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slugify turns the text into a branch name component, e.g. "Add foo (WIP)" => "add-foo-wip".
+func slugify(text string, maxLen int) string {
+	slug := strings.Trim(regexpNonSlug.ReplaceAllString(strings.ToLower(text), "-"), "-")
+	if len(slug) > maxLen {
+		slug = strings.TrimRight(slug[:maxLen], "-")
+	}
+	return coalesce(slug, "commit")
 }
 
 func findCommitWithoutRemoteRef(commits []*Commit) *Commit {
 	for _, commit := range commits {
-		if commit.Skip {
+		if commit.Skip || foreignStackToolOfCommit(commit) != "" {
 			continue
 		}
 		if commit.GetRemoteRef() == "" {
@@ -267,13 +484,66 @@ func findCommitWithoutRemoteRef(commits []*Commit) *Commit {
 	return nil
 }
 
+func ensureGitStatusClean() {
+	if !validateGitStatusClean() {
+		exitCodef(ExitDirtyWorktree, `"git status reports uncommitted changes"
+
+Hint: use "git add -A" and "git stash" to clean up the repository`)
+	}
+}
+
 func validateGitStatusClean() bool {
 	output := must(execGit("status"))
 	return strings.Contains(output, "nothing to commit, working tree clean")
 }
 
+// countCommitsUntil returns the number of commits of the stack up to -until (inclusive), or 0 to submit the whole
+// stack.
+func countCommitsUntil(originMain string) int {
+	if config.Until == "" {
+		return 0
+	}
+	until, err := execGit("rev-parse", "--verify", "--quiet", config.Until+"^{commit}")
+	until = strings.TrimSpace(until)
+	if err != nil || !isAncestor(until, head) || isAncestor(until, originMain) {
+		exitCodef(ExitConfig, "invalid -until %q: not a commit of the stack", config.Until)
+	}
+	return must(strconv.Atoi(strings.TrimSpace(must(execGit("rev-list", "--count", originMain+".."+until)))))
+}
+
+// ensureFullHistory offers to unshallow a shallow clone: the stack is found from the merge base with the main branch,
+// which may be cut off, so the commits of the main branch would be taken as part of the stack.
+func ensureFullHistory() {
+	out, _ := execGit("rev-parse", "--is-shallow-repository")
+	if strings.TrimSpace(out) != "true" {
+		return
+	}
+	fmt.Println("⚠️  this is a shallow clone: the stack can not be reliably told apart from the main branch")
+	if !promptYesNo(fmt.Sprintf("Fetch the full history from %v?", config.Remote)) {
+		exitCodef(ExitConfig, `shallow clones are not supported
+
+Hint: run "git fetch --unshallow %v"`, config.Remote)
+	}
+	must(execGitRemote(config.Remote, "fetch", "--unshallow", config.Remote))
+}
+
+// isMyOwnCommit reports whether the commit is authored with one of the user's emails: user.email, git-pr.email, or
+// the GitHub noreply address ("<id>+<user>@users.noreply.github.com").
 func isMyOwnCommit(commit *Commit) bool {
-	return commit.AuthorEmail == config.Email
+	email := commit.AuthorEmail
+	if strings.EqualFold(email, config.Email) {
+		return true
+	}
+	for _, e := range config.Emails {
+		if strings.EqualFold(email, e) {
+			return true
+		}
+	}
+	name, domain := splitEmail(email)
+	if _, login, ok := strings.Cut(name, "+"); ok {
+		name = login
+	}
+	return strings.EqualFold(domain, "@users.noreply."+config.Host) && strings.EqualFold(name, config.User)
 }
 
 func splitEmail(email string) (string, string) {
@@ -297,6 +567,14 @@ func shortenTitle(title string) string {
 	}
 }
 
+// shortHash shortens the hash to 8 characters, for the hashes from the API which may be empty or already short.
+func shortHash(hash string) string {
+	if len(hash) > 8 {
+		return hash[:8]
+	}
+	return hash
+}
+
 func coalesce(a, b string) string {
 	if a != "" {
 		return a
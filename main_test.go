@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		text   string
+		maxLen int
+		want   string
+	}{
+		{"Add foo (WIP)", 30, "add-foo-wip"},
+		{"[draft] Fix: the bar's baz", 30, "draft-fix-the-bar-s-baz"},
+		{"Refactor the parser for better error messages", 20, "refactor-the-parser"},
+		{"🚀", 30, "commit"},
+	}
+	for _, tt := range tests {
+		if got := slugify(tt.text, tt.maxLen); got != tt.want {
+			t.Errorf("slugify(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestShortHash(t *testing.T) {
+	for hash, want := range map[string]string{"": "", "1a2b3c": "1a2b3c", "1a2b3c4d5e6f": "1a2b3c4d"} {
+		if got := shortHash(hash); got != want {
+			t.Errorf("shortHash(%q) = %q, want %q", hash, got, want)
+		}
+	}
+}
+
+func TestFormatSubmitSummary(t *testing.T) {
+	config.Host, config.Repo = "github.com", "acme/app"
+	defer func() { config.Host, config.Repo = "", "" }()
+	commits := []*Commit{{Title: "Add the foo API", PRNumber: 12}, {Title: "Use the foo API", PRNumber: 123}}
+	stats := []CommitStats{{Files: 1, Insertions: 20}, {Files: 14, Insertions: 1200, Deletions: 318}}
+	want := "https://github.com/acme/app/pull/12      1 file     +20      -0  Add the foo API\n" +
+		"https://github.com/acme/app/pull/123   14 files   +1200    -318  Use the foo API\n"
+	if got := formatSubmitSummary(commits, stats); got != want {
+		t.Errorf("formatSubmitSummary() =\n%v\nwant\n%v", got, want)
+	}
+}
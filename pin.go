@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// resolveBaseRev returns the full hash of the pinned base commit, or "" when the stack follows the main branch. The
+// base must be a commit of the main branch, so that the PRs still target it.
+func resolveBaseRev(originMain string) string {
+	if config.BaseRev == "" {
+		return ""
+	}
+	baseHash, err := execGit("rev-parse", "--verify", "--quiet", config.BaseRev+"^{commit}")
+	if err != nil {
+		exitCodef(ExitConfig, "invalid base revision %q: not a commit\n\nHint: fetch it first, or unset %v", config.BaseRev, gitconfigBaseRev)
+	}
+	baseHash = strings.TrimSpace(baseHash)
+	if !isAncestor(baseHash, originMain) {
+		exitCodef(ExitConfig, "invalid base revision %q: not on %v", config.BaseRev, originMain)
+	}
+	return baseHash
+}
+
+// rebaseOntoBaseRev moves the stack onto the pinned base commit when it's based on another commit of the main branch,
+// e.g. after "git pull" or when the base is pinned for the first time.
+func rebaseOntoBaseRev(originMain, baseHash string) {
+	mergeBase := strings.TrimSpace(must(execGit("merge-base", originMain, head)))
+	if mergeBase == baseHash {
+		return
+	}
+	fmt.Printf("rebase the stack onto %v (pinned base)\n", baseHash[:8])
+	if _, err := execGit("rebase", "--onto", baseHash, mergeBase); err != nil {
+		exitCodef(ExitConflict, `failed to rebase the stack onto %v
+
+Hint: resolve the conflicts and run "git rebase --continue", then "git pr"`, baseHash[:8])
+	}
+}
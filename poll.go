@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// backoff yields adaptive polling intervals: it starts fast, grows up to Max, and adds random jitter, so that many
+// clients polling right after a push don't hit the API in lockstep.
+type backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+	Factor  float64
+
+	current time.Duration
+}
+
+func newBackoff(initial, max time.Duration) *backoff {
+	return &backoff{Initial: initial, Max: max, Factor: 1.5}
+}
+
+// Next returns the interval to wait before polling again.
+func (b *backoff) Next() time.Duration {
+	if b.current == 0 {
+		b.current = b.Initial
+	} else {
+		b.current = time.Duration(float64(b.current) * b.Factor)
+	}
+	if b.current > b.Max {
+		b.current = b.Max
+	}
+	// jitter: ±20%
+	jitter := time.Duration((rand.Float64()*0.4 - 0.2) * float64(b.current))
+	return b.current + jitter
+}
+
+// Reset makes the next poll fast again, e.g. after observing a change which likely triggers more changes.
+func (b *backoff) Reset() {
+	b.current = 0
+}
+
+// pollUntil calls check until it returns done, an error, or the timeout is reached. It returns whether it's done.
+func pollUntil(timeout time.Duration, b *backoff, check func() (done bool, err error)) (bool, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		done, err := check()
+		if done || err != nil {
+			return done, err
+		}
+		wait := b.Next()
+		if time.Now().Add(wait).After(deadline) {
+			return false, nil
+		}
+		time.Sleep(wait)
+	}
+}
+
+// pollBackoff returns the backoff for polling the API, which doesn't slow down as much with -fast.
+func pollBackoff(initial, max time.Duration) *backoff {
+	if config.Fast {
+		max /= 5
+	}
+	return newBackoff(xif(initial < max, initial, max), max)
+}
+
+// waitForPropagation waits until the API sees the pushed commits, on the branches and their PRs, instead of sleeping
+// for a fixed time: GitHub usually takes a few seconds, but much less on small repositories. The PRs are looked up or
+// updated right after, and would still see the previous heads. It gives up after git-pr.propagation-timeout.
+func waitForPropagation(commits []*Commit, pushHash func(*Commit) string) {
+	if len(commits) == 0 {
+		return
+	}
+	fmt.Printf("waiting for the pushes to show up...\n")
+	start, pending := time.Now(), commits
+	visible, err := pollUntil(config.PropagationTimeout, pollBackoff(xif(config.Fast, 100*time.Millisecond, 500*time.Millisecond), 5*time.Second), func() (bool, error) {
+		// on GitHub, the heads of all the PRs are queried at once
+		var states map[int]*PRState
+		if config.Forge == forgeGitHub {
+			var numbers []int
+			for _, commit := range pending {
+				if commit.PRNumber != 0 {
+					numbers = append(numbers, commit.PRNumber)
+				}
+			}
+			var err error
+			if states, err = githubGetPRStates(numbers); err != nil {
+				return false, err
+			}
+		}
+		var remaining []*Commit
+		for _, commit := range pending {
+			ok, err := isPushVisible(commit, pushHash(commit), states)
+			if err != nil {
+				return false, err
+			}
+			if !ok {
+				remaining = append(remaining, commit)
+			}
+		}
+		pending = remaining
+		return len(pending) == 0, nil
+	})
+	switch {
+	case err != nil:
+		debugf("failed to check the pushes: %v\n", err)
+	case !visible:
+		fmt.Printf("%v pushes did not show up after %v, continuing\n", len(pending), config.PropagationTimeout)
+	default:
+		debugf("the pushes showed up after %v\n", time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// isPushVisible reports whether the API sees the hash as the head of the PR of the commit, or of its branch when it has
+// no PR yet. The other forges than GitHub see the branches right away.
+func isPushVisible(commit *Commit, hash string, states map[int]*PRState) (bool, error) {
+	if state := states[commit.PRNumber]; state != nil {
+		return state.HeadRefOid == hash, nil
+	}
+	if commit.PRNumber != 0 {
+		pr, err := forge.GetPR(commit.PRNumber)
+		if err != nil {
+			return false, err
+		}
+		return pr.Head.Sha != "" && strings.HasPrefix(hash, pr.Head.Sha), nil // shortened on Bitbucket
+	}
+	if config.Forge != forgeGitHub {
+		return true, nil
+	}
+	sha, err := githubGetBranchSHA(commit.GetRemoteRef())
+	return sha == hash, err
+}
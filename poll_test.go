@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	b := newBackoff(time.Second, 4*time.Second)
+	expected := []time.Duration{time.Second, 1500 * time.Millisecond, 2250 * time.Millisecond, 3375 * time.Millisecond, 4 * time.Second, 4 * time.Second}
+	for i, base := range expected {
+		d := b.Next()
+		if d < base*8/10 || d > base*12/10 {
+			t.Errorf("Next() #%v = %v, want %v ±20%%", i, d, base)
+		}
+	}
+	b.Reset()
+	if d := b.Next(); d > 1200*time.Millisecond {
+		t.Errorf("Next() after Reset() = %v, want ~1s", d)
+	}
+}
+
+func TestPollBackoffFast(t *testing.T) {
+	defer func(fast bool) { config.Fast = fast }(config.Fast)
+	config.Fast = true
+	b := pollBackoff(5*time.Second, time.Minute)
+	if b.Initial != 5*time.Second || b.Max != 12*time.Second {
+		t.Errorf("pollBackoff(5s, 1m) with -fast = %v..%v, want 5s..12s", b.Initial, b.Max)
+	}
+	if b = pollBackoff(time.Minute, time.Minute); b.Initial != 12*time.Second {
+		t.Errorf("pollBackoff(1m, 1m) with -fast starts at %v, want 12s", b.Initial)
+	}
+}
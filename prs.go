@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// listStackPRs prints the URL of the PR of each commit in the stack, from the bottom to the top, without changing
+// anything. It's meant for scripts and chat messages: commits without PR are omitted.
+func listStackPRs(args []string) {
+	if len(args) > 0 {
+		exitCodef(ExitConfig, "usage: git pr prs [-markdown]")
+	}
+	originMain := fmt.Sprintf("%v/%v", config.Remote, config.MainBranch)
+	stackedCommits := must(getStackedCommits(originMain, head))
+
+	var wg sync.WaitGroup
+	for _, commit := range stackedCommits {
+		commit := commit
+		if commit.GetRemoteRef() == "" {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer forwardErrors()
+			commit.PRNumber = must(githubGetPRNumberByHead(commit.GetRemoteRef()))
+		}()
+	}
+	waitGoroutines(&wg)
+
+	for _, commit := range stackedCommits {
+		if commit.PRNumber == 0 {
+			continue
+		}
+		prURL := fmt.Sprintf("https://%v/%v/pull/%v", config.Host, config.Repo, commit.PRNumber)
+		if config.PRsMarkdown {
+			fmt.Printf("- [#%v %v](%v)\n", commit.PRNumber, commit.Title, prURL)
+		} else {
+			fmt.Println(prURL)
+		}
+	}
+}
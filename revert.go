@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// revertPRs creates one revert commit for each landed PR on top of the main branch (detached, like a new stack), then
+// submits the stack, so the reverts go through the usual review process as new PRs.
+func revertPRs(args []string) {
+	if len(args) == 0 {
+		exitCodef(ExitConfig, "usage: git pr revert <pr>...")
+	}
+	ensureGitStatusClean()
+
+	var numbers []int
+	for _, arg := range args {
+		number, err := strconv.Atoi(strings.TrimPrefix(arg, "#"))
+		if err != nil {
+			exitCodef(ExitConfig, "invalid pull request number %q", arg)
+		}
+		numbers = append(numbers, number)
+	}
+	_ = os.Remove(filepath.Join(gitPRDir(), "revert-remaining")) // from a previous revert, not continued
+
+	originMain := fmt.Sprintf("%v/%v", config.Remote, config.MainBranch)
+	must(execGitRemote(config.Remote, "fetch", config.Remote, config.MainBranch))
+	prs := getMergedPRs(numbers, originMain)
+	must(execGit("checkout", "--detach", originMain))
+	revertOnHead(prs)
+	submitStack()
+}
+
+// getMergedPRs returns the PRs to revert, latest merged first. Their merge commits must be on the main branch: a PR
+// merged into another branch, or whose merge commit was dropped by a force-push, can not be reverted there.
+func getMergedPRs(numbers []int, originMain string) []*PR {
+	var prs []*PR
+	for _, number := range numbers {
+		pr := must(githubGetPRByNumber(number))
+		if pr.MergedAt == nil || pr.MergeCommitSHA == "" {
+			exitf("pull request #%v is not merged", number)
+		}
+		if _, err := execGit("merge-base", "--is-ancestor", pr.MergeCommitSHA, originMain); err != nil {
+			exitf("pull request #%v was merged as %v, which is not on %v", number, shortHash(pr.MergeCommitSHA), originMain)
+		}
+		prs = append(prs, pr)
+	}
+	sort.Slice(prs, func(i, j int) bool {
+		return prs[i].MergedAt.After(*prs[j].MergedAt)
+	})
+	return prs
+}
+
+// revertOnHead creates the revert commits on top of HEAD. On conflicts, the remaining PRs are saved for "git pr
+// continue", which reverts them on top of the resolved commit.
+func revertOnHead(prs []*PR) {
+	for i, pr := range prs {
+		fmt.Printf("revert #%v %q (%v)\n", pr.Number, pr.Title, shortHash(pr.MergeCommitSHA))
+		revertArgs := []string{"revert", "--no-commit"}
+		if isMergeCommit(pr.MergeCommitSHA) {
+			revertArgs = append(revertArgs, "-m", "1")
+		}
+		revertArgs = append(revertArgs, pr.MergeCommitSHA)
+		if _, err := execGit(revertArgs...); err != nil {
+			// keep the prepared message, with its Reverts: trailer, for committing after resolving the conflicts
+			msgPath := filepath.Join(gitPRDir(), "revert-message")
+			must(0, os.WriteFile(msgPath, []byte(revertMessage(pr)), 0644))
+			hint := fmt.Sprintf(`resolve the conflicts and run "git commit -F %v", then "git pr"`, msgPath)
+			if remaining := prs[i+1:]; len(remaining) > 0 {
+				must(0, os.WriteFile(filepath.Join(gitPRDir(), "revert-remaining"), []byte(formatPRNumbers(remaining)), 0644))
+				hint = fmt.Sprintf(`resolve the conflicts and run "git commit -F %v", then "git pr continue" to revert the remaining PRs on top of it and submit`, msgPath)
+			}
+			exitCodef(ExitConflict, "failed to revert #%v\n\nHint: %v", pr.Number, hint)
+		}
+		must(execGit("commit", "-m", revertMessage(pr)))
+	}
+}
+
+// continueReverts reverts the PRs which remained after a conflict, on top of the current HEAD with the resolved
+// commit. It returns false when there is no revert to continue.
+func continueReverts() bool {
+	remainingPath := filepath.Join(gitPRDir(), "revert-remaining")
+	data, err := os.ReadFile(remainingPath)
+	if err != nil {
+		return false
+	}
+	ensureGitStatusClean()
+	var numbers []int
+	for _, field := range strings.Fields(string(data)) {
+		numbers = append(numbers, must(strconv.Atoi(field)))
+	}
+	_ = os.Remove(remainingPath)
+
+	originMain := fmt.Sprintf("%v/%v", config.Remote, config.MainBranch)
+	prs := getMergedPRs(numbers, originMain)
+	fmt.Printf("continue reverting %v on top of %v\n", formatPRNumbers(prs), shortHash(strings.TrimSpace(must(execGit("rev-parse", head)))))
+	revertOnHead(prs)
+	return true
+}
+
+func revertMessage(pr *PR) string {
+	prURL := fmt.Sprintf("https://%v/%v/pull/%v", config.Host, config.Repo, pr.Number)
+	commit := &Commit{
+		Title:   fmt.Sprintf("Revert %q (#%v)", pr.Title, pr.Number),
+		Message: fmt.Sprintf("This reverts commit %v from %v.", pr.MergeCommitSHA, prURL),
+	}
+	commit.SetAttr(KeyReverts, fmt.Sprintf("#%v", pr.Number))
+	return commit.FullMessage()
+}
+
+// formatPRNumbers formats the numbers of the PRs for the command line, e.g. "123 124".
+func formatPRNumbers(prs []*PR) string {
+	numbers := make([]string, len(prs))
+	for i, pr := range prs {
+		numbers[i] = strconv.Itoa(pr.Number)
+	}
+	return strings.Join(numbers, " ")
+}
+
+func isMergeCommit(hash string) bool {
+	out := must(execGit("rev-list", "--parents", "-n", "1", hash))
+	return len(strings.Fields(out)) > 2
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// reviewStack lets a reviewer step through a stack of PRs from the bottom to the top: each PR is checked out locally,
+// with its diff against the previous PR, and can be approved or commented on from the terminal.
+func reviewStack(args []string) {
+	if len(args) != 1 {
+		exitCodef(ExitConfig, "usage: git pr review <stack-top-pr>")
+	}
+	number, err := strconv.Atoi(strings.TrimPrefix(args[0], "#"))
+	if err != nil {
+		exitCodef(ExitConfig, "invalid pull request number %q", args[0])
+	}
+	if !isTerminal(os.Stdin) {
+		exitCodef(ExitConfig, "review requires an interactive terminal")
+	}
+	ensureGitStatusClean()
+
+	// walk down the bases to the main branch
+	var prs []*PR
+	for number != 0 {
+		pr := must(githubGetPRByNumber(number))
+		prs = append([]*PR{pr}, prs...)
+		if pr.Base.Ref == config.MainBranch {
+			break
+		}
+		number = must(githubGetPRNumberByHead(pr.Base.Ref))
+	}
+	fetchArgs := []string{"fetch", config.Remote}
+	for _, pr := range prs {
+		fetchArgs = append(fetchArgs, fmt.Sprintf("refs/heads/%v:refs/remotes/%v/%v", pr.Head.Ref, config.Remote, pr.Head.Ref))
+	}
+	must(execGitRemote(config.Remote, fetchArgs...))
+
+	original := strings.TrimSpace(must(execGit("rev-parse", "--abbrev-ref", head)))
+	if original == head {
+		original = strings.TrimSpace(must(execGit("rev-parse", head)))
+	}
+	defer func() {
+		fmt.Printf("\ncheckout %v\n", original)
+		must(execGit("checkout", original))
+	}()
+
+	for i := 0; i < len(prs); {
+		pr := prs[i]
+		printReviewStack(prs, i)
+		headRef := fmt.Sprintf("%v/%v", config.Remote, pr.Head.Ref)
+		baseRef := fmt.Sprintf("%v/%v", config.Remote, pr.Base.Ref)
+		must(execGit("checkout", "--detach", headRef))
+		fmt.Println(must(execGit("diff", "--stat", baseRef+"..."+headRef)))
+
+		action := strings.ToLower(promptString("[a]pprove, [c]omment, [r]equest changes, [n]ext, [p]revious, [q]uit:"))
+		switch action {
+		case "a":
+			body := promptString("comment (optional):")
+			must(0, githubCreateReview(pr.Number, "APPROVE", body))
+			fmt.Printf("approved #%v\n", pr.Number)
+			i++
+		case "c", "r":
+			body := promptString("comment:")
+			if body == "" {
+				continue
+			}
+			event := xif(action == "c", "COMMENT", "REQUEST_CHANGES")
+			must(0, githubCreateReview(pr.Number, event, body))
+			fmt.Printf("reviewed #%v\n", pr.Number)
+		case "n", "":
+			i++
+		case "p":
+			i = xif(i > 0, i-1, 0)
+		case "q":
+			return
+		}
+	}
+}
+
+func printReviewStack(prs []*PR, current int) {
+	fmt.Println()
+	for i := len(prs) - 1; i >= 0; i-- {
+		pr := prs[i]
+		marker := xif(i == current, "👉", "  ")
+		fmt.Printf("%v #%v %v (@%v)\n", marker, pr.Number, pr.Title, pr.User.Login)
+	}
+	fmt.Println()
+}
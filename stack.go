@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// getStackName returns the name of the stack from the "Stack:" trailer of any of its commits, or "" when none has it.
+func getStackName(commits []*Commit) string {
+	for _, commit := range commits {
+		if name := commit.GetAttr(KeyStack); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// checkoutStack checks out the stack with the name from -stack, so that the command runs on it instead of the current
+// one, and checks out the previous branch or commit back when the command exits. The name is a local branch, or the
+// "Stack:" trailer of a commit on top of the main branch.
+func checkoutStack(name string) {
+	originMain := fmt.Sprintf("%v/%v", config.Remote, config.MainBranch)
+	branch := findStack(originMain, name)
+	current, _ := execGit("symbolic-ref", "-q", "--short", head)
+	current = strings.TrimSpace(current)
+	if current == branch || branch == head {
+		return
+	}
+	ensureGitStatusClean()
+	if current == "" {
+		current = strings.TrimSpace(must(execGit("rev-parse", head))) // detached HEAD
+	}
+	fmt.Printf("checkout stack %v (%v)\n\n", name, branch)
+	must(execGit("checkout", branch))
+	onExit(func() {
+		if _, err := execGit("checkout", current); err != nil {
+			fmt.Printf("\nstay on stack %v: failed to checkout %v back: %v\n", name, current, err)
+		}
+	})
+}
+
+// findStack returns the branch (or the detached HEAD) at the top of the named stack. It exits when no stack or more
+// than one has the name.
+func findStack(originMain, name string) string {
+	if _, err := execGit("show-ref", "--verify", "--quiet", "refs/heads/"+name); err == nil {
+		return name
+	}
+	var candidates []string
+	out := must(execGit("for-each-ref", "--format=%(refname:short)", "refs/heads/"))
+	for _, branch := range strings.Fields(out) {
+		if branch != config.MainBranch {
+			candidates = append(candidates, branch)
+		}
+	}
+	if _, err := execGit("symbolic-ref", "-q", head); err != nil {
+		candidates = append(candidates, head) // detached HEAD, e.g. with git-branchless
+	}
+
+	var matches, names []string
+	for _, branch := range candidates {
+		stackName := getStackName(must(getStackedCommits(originMain, branch)))
+		switch {
+		case stackName == name:
+			matches = append(matches, branch)
+		case stackName != "" && !containsString(names, stackName):
+			names = append(names, stackName)
+		}
+	}
+	// a branch in the middle of the stack has the trailer too: keep the top ones
+	var tops []string
+	for _, branch := range matches {
+		contained := false
+		for _, other := range matches {
+			if other != branch && isAncestor(branch, other) && !isAncestor(other, branch) {
+				contained = true
+				break
+			}
+		}
+		if !contained && !containsString(tops, branch) {
+			tops = append(tops, branch)
+		}
+	}
+	switch {
+	case len(tops) > 1:
+		exitCodef(ExitConfig, "more than one stack named %q: %v\n\nHint: use the branch name instead", name, strings.Join(tops, ", "))
+	case len(tops) == 0 && len(names) > 0:
+		exitCodef(ExitConfig, "no stack named %q\n\nHint: the named stacks are %v", name, strings.Join(names, ", "))
+	case len(tops) == 0:
+		exitCodef(ExitConfig, "no stack named %q\n\nHint: name a stack with a branch or a \"Stack: <name>\" trailer", name)
+	}
+	return tops[0]
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// StackState is the association between the commits of a stack and their PRs, for moving a stack to another machine
+// or handing it to a colleague.
+type StackState struct {
+	Repo       string        `json:"repo"`
+	MainBranch string        `json:"main_branch"`
+	HeadOwner  string        `json:"head_owner,omitempty"` // the owner of the fork, when pushing to a fork
+	Commits    []CommitState `json:"commits"`              // from the bottom of the stack
+}
+
+type CommitState struct {
+	Hash      string `json:"hash"`
+	Title     string `json:"title"`
+	RemoteRef string `json:"remote_ref"`
+	PRNumber  int    `json:"pr,omitempty"`
+	Base      string `json:"base"`
+}
+
+func stateCommand(args []string) {
+	switch {
+	case len(args) == 1 && args[0] == "export":
+		exportStackState()
+	case len(args) <= 2 && len(args) > 0 && args[0] == "import":
+		importStackState(args[1:])
+	default:
+		exitCodef(ExitConfig, "usage: git pr state export > stack.json\n       git pr state import [stack.json]")
+	}
+}
+
+// exportStackState prints the state of the stack as json.
+func exportStackState() {
+	originMain := fmt.Sprintf("%v/%v", config.Remote, config.MainBranch)
+	stackedCommits := must(getStackedCommits(originMain, head))
+	if len(stackedCommits) == 0 {
+		exitf("no commits to export")
+	}
+	state := StackState{Repo: config.Repo, MainBranch: config.MainBranch}
+	if repo := must(githubGetRepo(config.Repo)); !repo.Permissions.Push {
+		config.HeadOwner = config.User // the stack is pushed to the user's fork
+		state.HeadOwner = config.HeadOwner
+	}
+	var prev *Commit
+	for _, commit := range stackedCommits {
+		remoteRef := commit.GetRemoteRef()
+		if remoteRef == "" {
+			continue
+		}
+		commitState := CommitState{
+			Hash:      commit.Hash,
+			Title:     commit.Title,
+			RemoteRef: remoteRef,
+			PRNumber:  must(githubGetPRNumberByHead(remoteRef)),
+			Base:      prBase(prev),
+		}
+		state.Commits = append(state.Commits, commitState)
+		prev = commit
+	}
+	data := must(json.MarshalIndent(state, "", "  "))
+	fmt.Println(string(data))
+}
+
+// importStackState restores the Remote-Ref of the local commits from an exported state, matching them by hash then by
+// title. When there is no local stack, the top of the exported stack is fetched and checked out first.
+func importStackState(args []string) {
+	var data []byte
+	if len(args) == 0 || args[0] == "-" {
+		data = must(io.ReadAll(os.Stdin))
+	} else {
+		data = must(os.ReadFile(args[0]))
+	}
+	var state StackState
+	if err := json.Unmarshal(data, &state); err != nil {
+		exitCodef(ExitConfig, "failed to parse stack state: %v", err)
+	}
+	if state.Repo != config.Repo {
+		exitCodef(ExitConfig, "the stack state is for %v, not %v", state.Repo, config.Repo)
+	}
+	if len(state.Commits) == 0 {
+		exitf("no commits to import")
+	}
+
+	originMain := fmt.Sprintf("%v/%v", config.Remote, config.MainBranch)
+	stackedCommits := must(getStackedCommits(originMain, head))
+	if len(stackedCommits) == 0 {
+		ensureGitStatusClean()
+		remote := xif(state.HeadOwner != "", config.ForkRemote, config.Remote)
+		top := state.Commits[len(state.Commits)-1]
+		fmt.Printf("fetch %v from %v\n", top.RemoteRef, remote)
+		must(execGitRemote(remote, "fetch", remote, "refs/heads/"+top.RemoteRef))
+		must(execGit("checkout", "FETCH_HEAD"))
+		stackedCommits = must(getStackedCommits(originMain, head))
+	}
+
+	// fill remote ref for each commit
+	findCommitToImport := func() (*Commit, *CommitState) {
+		for _, commit := range stackedCommits {
+			if commit.GetRemoteRef() != "" {
+				continue
+			}
+			if commitState := matchCommitState(commit, stackedCommits, state.Commits); commitState != nil {
+				return commit, commitState
+			}
+		}
+		return nil, nil
+	}
+	for commit, commitState := findCommitToImport(); commit != nil; commit, commitState = findCommitToImport() {
+		commit.SetAttr(KeyRemoteRef, commitState.RemoteRef)
+		must(execGit("reword", commit.Hash, "-m", commit.FullMessage()))
+
+		time.Sleep(500 * time.Millisecond)
+		stackedCommits = must(getStackedCommits(originMain, head))
+	}
+
+	found := map[string]bool{}
+	for _, commit := range stackedCommits {
+		commitState := findCommitStateByRef(state.Commits, commit.GetRemoteRef())
+		if commitState == nil {
+			fmt.Printf("%v (not in the stack state)\n", commit)
+			continue
+		}
+		found[commitState.RemoteRef] = true
+		fmt.Printf("%v #%v (base %v)\n", commit, commitState.PRNumber, commitState.Base)
+	}
+	var missing []string
+	for _, commitState := range state.Commits {
+		if !found[commitState.RemoteRef] {
+			missing = append(missing, fmt.Sprintf("  %v %v", commitState.RemoteRef, commitState.Title))
+		}
+	}
+	if len(missing) > 0 {
+		fmt.Printf("\nthese commits of the stack state are not found locally:\n%v\n", strings.Join(missing, "\n"))
+	}
+}
+
+// matchCommitState finds the state of a commit without Remote-Ref, by hash or by a title which is unique in both the
+// stack and the state. States whose Remote-Ref is already used in the stack are ignored.
+func matchCommitState(commit *Commit, commits []*Commit, states []CommitState) *CommitState {
+	used := map[string]bool{}
+	titles := map[string]int{}
+	for _, cm := range commits {
+		used[cm.GetRemoteRef()] = true
+		titles[cm.Title]++
+	}
+	var byTitle *CommitState
+	titleCount := 0
+	for i := range states {
+		commitState := &states[i]
+		if used[commitState.RemoteRef] {
+			continue
+		}
+		if commitState.Hash == commit.Hash {
+			return commitState
+		}
+		if commitState.Title == commit.Title {
+			byTitle = commitState
+			titleCount++
+		}
+	}
+	if titleCount == 1 && titles[commit.Title] == 1 {
+		return byTitle
+	}
+	return nil
+}
+
+func findCommitStateByRef(states []CommitState, remoteRef string) *CommitState {
+	for i := range states {
+		if remoteRef != "" && states[i].RemoteRef == remoteRef {
+			return &states[i]
+		}
+	}
+	return nil
+}
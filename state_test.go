@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestMatchCommitState(t *testing.T) {
+	commits := []*Commit{
+		{Hash: "aaaaaaaa1", Title: "add foo", Attrs: []KeyVal{{KeyRemoteRef, "me/1"}}},
+		{Hash: "bbbbbbbb2", Title: "add bar"},
+		{Hash: "cccccccc3", Title: "fix"},
+		{Hash: "dddddddd4", Title: "fix"},
+	}
+	states := []CommitState{
+		{Hash: "aaaaaaaa0", Title: "add foo", RemoteRef: "me/1"},
+		{Hash: "bbbbbbbb0", Title: "add bar", RemoteRef: "me/2"},
+		{Hash: "cccccccc0", Title: "fix", RemoteRef: "me/3"},
+		{Hash: "dddddddd4", Title: "fix", RemoteRef: "me/4"},
+	}
+	tests := []struct {
+		commit *Commit
+		want   string
+	}{
+		{commits[1], "me/2"}, // by title
+		{commits[2], ""},     // ambiguous title
+		{commits[3], "me/4"}, // by hash
+	}
+	for _, tt := range tests {
+		got := ""
+		if commitState := matchCommitState(tt.commit, commits, states); commitState != nil {
+			got = commitState.RemoteRef
+		}
+		if got != tt.want {
+			t.Errorf("matchCommitState(%v) = %q, want %q", tt.commit.Title, got, tt.want)
+		}
+	}
+}
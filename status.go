@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PRStatus is the state of the PR of a commit in the stack.
+type PRStatus struct {
+	Commit  *Commit
+	PR      *PR // nil when the commit has no open PR
+	Reviews []Review
+
+	RequiredApprovals int      // from the rulesets and branch protection of the main branch
+	CodeOwners        []string // owners of the files changed by the commit, when code owner review is required
+
+	Checks        []CheckRun
+	UsualDuration map[string]time.Duration // how long each check usually takes
+
+	Dependencies []*PR // from the "Depends-On:" trailers
+
+	Verification *Verification // of the head commit of the PR, only when the main branch requires signatures
+
+	LastSubmit *SubmitResult // nil when the commit was never submitted from this repository
+}
+
+// statusStack prints the PRs of the stack, from the top to the bottom.
+func statusStack(args []string) {
+	if len(args) > 0 {
+		exitCodef(ExitConfig, "usage: git pr status [-stale]")
+	}
+	originMain := fmt.Sprintf("%v/%v", config.Remote, config.MainBranch)
+	stackedCommits := must(getStackedCommits(originMain, head))
+	if len(stackedCommits) == 0 {
+		exitf("no commits in the stack")
+	}
+	statuses := loadStackStatus(stackedCommits)
+	required := must(githubGetRequiredReviews(config.MainBranch))
+	var codeOwners []codeOwnersRule
+	if required.CodeOwners {
+		codeOwners = loadCodeOwners()
+	}
+	usualDurations := checkDurations()
+	requireSignatures := must(githubRequiresSignatures(config.MainBranch))
+	submits := loadSubmitResults()
+	var wg sync.WaitGroup
+	for _, status := range statuses {
+		status := status
+		status.LastSubmit = submits[status.Commit.GetRemoteRef()]
+		status.RequiredApprovals = required.Approvals
+		status.CodeOwners = getCodeOwnersOfCommit(codeOwners, status.Commit.Hash)
+		status.UsualDuration = usualDurations
+		if status.PR == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer forwardErrors()
+			status.Checks = latestCheckRuns(must(githubListCheckRuns(status.PR.Head.Sha)))
+			if requireSignatures {
+				verification := must(githubGetCommitVerification(status.PR.Head.Sha))
+				status.Verification = &verification
+			}
+		}()
+	}
+	waitGoroutines(&wg)
+	now := time.Now()
+	for i := len(statuses) - 1; i >= 0; i-- {
+		status := statuses[i]
+		stale := status.StaleReason(now)
+		if config.StatusStale && stale == "" {
+			continue
+		}
+		fmt.Println(status.Format(now))
+	}
+}
+
+// loadStackStatus finds the open PR of each commit and its reviews, concurrently.
+func loadStackStatus(commits []*Commit) []*PRStatus {
+	statuses := make([]*PRStatus, len(commits))
+	var wg sync.WaitGroup
+	for i, commit := range commits {
+		i, commit := i, commit
+		statuses[i] = &PRStatus{Commit: commit}
+		if len(getDependsOn(commit)) > 0 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer forwardErrors()
+				statuses[i].Dependencies = loadDependencies(commit)
+			}()
+		}
+		number := commit.PRNumber
+		if number == 0 && commit.GetRemoteRef() == "" {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer forwardErrors()
+			if number == 0 {
+				number = must(githubGetPRNumberByHead(commit.GetRemoteRef()))
+			}
+			if number == 0 {
+				return
+			}
+			statuses[i].PR = must(githubGetPRByNumber(number))
+			statuses[i].Reviews = must(githubListReviews(number))
+		}()
+	}
+	waitGoroutines(&wg)
+	return statuses
+}
+
+// LatestReviews returns the latest review of each reviewer which counts toward the review decision, like GitHub does:
+// comments don't change a previous approval or change request, and dismissed reviews don't count.
+func (s *PRStatus) LatestReviews() (reviews []Review) {
+	latest := map[string]int{} // login -> index in reviews
+	for _, review := range s.Reviews {
+		if review.State != "APPROVED" && review.State != "CHANGES_REQUESTED" && review.State != "DISMISSED" {
+			continue
+		}
+		idx, ok := latest[review.User.Login]
+		if !ok {
+			latest[review.User.Login] = len(reviews)
+			reviews = append(reviews, review)
+			continue
+		}
+		if review.SubmittedAt == nil || reviews[idx].SubmittedAt == nil || !review.SubmittedAt.Before(*reviews[idx].SubmittedAt) {
+			reviews[idx] = review
+		}
+	}
+	out := reviews[:0]
+	for _, review := range reviews {
+		if review.State != "DISMISSED" {
+			out = append(out, review)
+		}
+	}
+	return out
+}
+
+// ApprovedAt returns the time of the latest approval, or nil if not approved.
+func (s *PRStatus) ApprovedAt() (approvedAt *time.Time) {
+	for _, review := range s.LatestReviews() {
+		if review.State == "APPROVED" && review.SubmittedAt != nil {
+			if approvedAt == nil || review.SubmittedAt.After(*approvedAt) {
+				approvedAt = review.SubmittedAt
+			}
+		}
+	}
+	return approvedAt
+}
+
+// StaleReason returns why the PR needs attention, or "" if it's not stale. The thresholds come from git config
+// git-pr.stale-approved-days and git-pr.stale-inactive-days, 0 to disable.
+func (s *PRStatus) StaleReason(now time.Time) string {
+	if s.PR == nil {
+		return ""
+	}
+	day := 24 * time.Hour
+	if approvedAt := s.ApprovedAt(); approvedAt != nil && config.StaleApprovedDays > 0 {
+		if age := now.Sub(*approvedAt); age > time.Duration(config.StaleApprovedDays)*day {
+			return fmt.Sprintf("approved %v ago — land it?", formatAge(age))
+		}
+	}
+	if s.PR.UpdatedAt != nil && config.StaleInactiveDays > 0 {
+		if age := now.Sub(*s.PR.UpdatedAt); age > time.Duration(config.StaleInactiveDays)*day {
+			return fmt.Sprintf("no activity for %v", formatAge(age))
+		}
+	}
+	return ""
+}
+
+// Approvers returns the users whose latest review approved the PR.
+func (s *PRStatus) Approvers() []string {
+	return s.reviewersWithState("APPROVED")
+}
+
+// ChangesRequestedBy returns the users whose latest review requested changes.
+func (s *PRStatus) ChangesRequestedBy() []string {
+	return s.reviewersWithState("CHANGES_REQUESTED")
+}
+
+func (s *PRStatus) reviewersWithState(state string) (logins []string) {
+	for _, review := range s.LatestReviews() {
+		if review.State == state {
+			logins = append(logins, review.User.Login)
+		}
+	}
+	return logins
+}
+
+// PendingReviews describes the approvals still needed to merge the PR, or "" if none.
+func (s *PRStatus) PendingReviews() string {
+	approvers := s.Approvers()
+	var parts []string
+	if missing := s.RequiredApprovals - len(approvers); missing > 0 {
+		parts = append(parts, fmt.Sprintf("needs %v more %v", missing, xif(missing == 1, "approval", "approvals")))
+	}
+	var pendingOwners []string
+	for _, owner := range s.CodeOwners {
+		approved := false
+		for _, approver := range approvers {
+			approved = approved || strings.EqualFold(owner, "@"+approver)
+		}
+		if !approved {
+			pendingOwners = append(pendingOwners, owner)
+		}
+	}
+	if len(pendingOwners) > 0 {
+		parts = append(parts, "code owners: "+strings.Join(pendingOwners, " "))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (s *PRStatus) Format(now time.Time) string {
+	commit := s.Commit
+	hold := xif(isHeld(commit), "⏸️  on hold, ", "")
+	lastSubmit := s.LastSubmit.Describe(commit, now)
+	if s.PR == nil {
+		return fmt.Sprintf("      %v %v — %vno open pull request%v", commit.ShortHash(), commit.Title, hold, xif(lastSubmit != "", ", "+lastSubmit, ""))
+	}
+	var parts []string
+	if hold != "" {
+		parts = append(parts, "⏸️  on hold")
+	}
+	if lastSubmit != "" {
+		parts = append(parts, lastSubmit)
+	}
+	if approvers := s.Approvers(); len(approvers) > 0 {
+		parts = append(parts, "approved by "+strings.Join(approvers, ", "))
+	}
+	if requesters := s.ChangesRequestedBy(); len(requesters) > 0 {
+		parts = append(parts, "changes requested by "+strings.Join(requesters, ", "))
+	}
+	if pending := s.PendingReviews(); pending != "" {
+		parts = append(parts, pending)
+	}
+	if deps := formatDependencies(s.Dependencies); deps != "" {
+		parts = append(parts, "waiting for "+deps)
+	}
+	if s.Verification != nil {
+		parts = append(parts, formatVerification(*s.Verification))
+	}
+	if s.PR.UpdatedAt != nil {
+		parts = append(parts, fmt.Sprintf("updated %v ago", formatAge(now.Sub(*s.PR.UpdatedAt))))
+	}
+	if checks := summarizeChecks(s.Checks, s.UsualDuration, now); checks != "" {
+		parts = append(parts, "checks: "+checks)
+	}
+	if stale := s.StaleReason(now); stale != "" {
+		parts = append(parts, "💤 "+stale)
+	}
+	return fmt.Sprintf("%5v %v %v — %v", fmt.Sprintf("#%v", s.PR.Number), commit.ShortHash(), commit.Title, strings.Join(parts, ", "))
+}
+
+func formatVerification(v Verification) string {
+	if v.Verified {
+		return "signature verified"
+	}
+	return fmt.Sprintf("⚠️  signature not verified (%v)", strings.ReplaceAll(v.Reason, "_", " "))
+}
+
+// printStaleNudges reminds the user about the PRs of the stack which need attention.
+func printStaleNudges(statuses []*PRStatus) {
+	now := time.Now()
+	printed := false
+	for _, status := range statuses {
+		if stale := status.StaleReason(now); stale != "" {
+			if !printed {
+				fmt.Println()
+				printed = true
+			}
+			fmt.Printf("💤 #%v %v\n", status.PR.Number, stale)
+		}
+	}
+}
+
+func formatAge(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour:
+		return fmt.Sprintf("%v days", int(d/(24*time.Hour)))
+	case d >= 2*time.Hour:
+		return fmt.Sprintf("%v hours", int(d/time.Hour))
+	default:
+		return fmt.Sprintf("%v minutes", int(d/time.Minute))
+	}
+}
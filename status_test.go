@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLatestReviews(t *testing.T) {
+	review := func(login, state string, minute int) Review {
+		at := time.Date(2024, 1, 1, 0, minute, 0, 0, time.UTC)
+		r := Review{State: state, SubmittedAt: &at}
+		r.User.Login = login
+		return r
+	}
+	status := &PRStatus{Reviews: []Review{
+		review("alice", "APPROVED", 1),
+		review("alice", "APPROVED", 2),
+		review("alice", "APPROVED", 3),
+		review("bob", "CHANGES_REQUESTED", 1),
+		review("bob", "COMMENTED", 2),
+		review("bob", "APPROVED", 3),
+		review("carol", "CHANGES_REQUESTED", 1),
+		review("carol", "COMMENTED", 2),
+		review("dave", "APPROVED", 1),
+		review("dave", "DISMISSED", 2),
+	}}
+	if approvers := strings.Join(status.Approvers(), ","); approvers != "alice,bob" {
+		t.Errorf("Approvers() = %v, want alice,bob", approvers)
+	}
+	if requesters := strings.Join(status.ChangesRequestedBy(), ","); requesters != "carol" {
+		t.Errorf("ChangesRequestedBy() = %v, want carol", requesters)
+	}
+}
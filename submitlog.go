@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SubmitResult is the outcome of the last submit of a commit, kept in .git/git-pr/submits.json by Remote-Ref, to tell
+// from "git pr status" which PRs are behind after a failed run.
+type SubmitResult struct {
+	Hash      string     `json:"hash"`             // the local commit when submitting
+	Pushed    string     `json:"pushed,omitempty"` // the commit on the remote branch after the push
+	PRNumber  int        `json:"pr,omitempty"`
+	Step      string     `json:"step,omitempty"`       // the last step done in the submit
+	UpdatedAt *time.Time `json:"updated_at,omitempty"` // when the PR was last updated
+	Error     string     `json:"error,omitempty"`
+	Time      time.Time  `json:"time"`
+}
+
+// The steps of submitting a commit, in order.
+const (
+	submitStepPushed  = "pushed"  // the branch has the commit
+	submitStepPR      = "pr"      // the PR exists
+	submitStepUpdated = "updated" // the title, body, labels, etc. of the PR are updated
+)
+
+var (
+	submitResults   map[string]*SubmitResult
+	submitResultsMu sync.Mutex
+)
+
+func submitResultsPath() string {
+	return filepath.Join(gitPRDir(), "submits.json")
+}
+
+// loadSubmitResults reads the results of the previous submits. A missing or invalid file means no results.
+func loadSubmitResults() map[string]*SubmitResult {
+	results := map[string]*SubmitResult{}
+	data, err := os.ReadFile(submitResultsPath())
+	if err != nil {
+		return results
+	}
+	if err = json.Unmarshal(data, &results); err != nil {
+		debugf("failed to parse the submit results (ignored): %v\n", err)
+	}
+	return results
+}
+
+// beginSubmitResults marks the commits as being submitted, so that an interrupted run is reported as failed.
+func beginSubmitResults(commits []*Commit) {
+	submitResultsMu.Lock()
+	submitResults = loadSubmitResults()
+	now := time.Now()
+	for _, commit := range commits {
+		remoteRef := commit.GetRemoteRef()
+		if commit.Skip || remoteRef == "" {
+			continue
+		}
+		result := submitResults[remoteRef]
+		if result == nil {
+			result = &SubmitResult{}
+			submitResults[remoteRef] = result
+		}
+		result.Hash, result.Time, result.Error, result.Step = commit.Hash, now, "interrupted", ""
+	}
+	submitResultsMu.Unlock()
+	saveSubmitResults()
+}
+
+// setSubmitResult updates the result of the commit in the current submit.
+func setSubmitResult(commit *Commit, update func(result *SubmitResult)) {
+	submitResultsMu.Lock()
+	defer submitResultsMu.Unlock()
+	if result := submitResults[commit.GetRemoteRef()]; result != nil {
+		update(result)
+	}
+}
+
+func saveSubmitResults() {
+	submitResultsMu.Lock()
+	defer submitResultsMu.Unlock()
+	if submitResults == nil {
+		return
+	}
+	data := must(json.MarshalIndent(submitResults, "", "  "))
+	if err := os.WriteFile(submitResultsPath(), data, 0644); err != nil {
+		debugf("failed to save the submit results (ignored): %v\n", err)
+	}
+}
+
+// recordSubmitError is deferred in the steps which submit a commit: it records the error of the commit before
+// panicking again.
+func recordSubmitError(commit *Commit) {
+	if r := recover(); r != nil {
+		setSubmitResult(commit, func(result *SubmitResult) {
+			result.Error = fmt.Sprint(r)
+		})
+		saveSubmitResults()
+		panic(r)
+	}
+}
+
+// Describe tells how the last submit of the commit went, or "" when it's unknown.
+func (result *SubmitResult) Describe(commit *Commit, now time.Time) string {
+	switch {
+	case result == nil:
+		return ""
+	case result.Error != "":
+		msg, _, _ := strings.Cut(strings.TrimSpace(result.Error), "\n")
+		return fmt.Sprintf("⚠️  last submit failed %v ago: %v", formatAge(now.Sub(result.Time)), msg)
+	case result.Hash != commit.Hash:
+		return "changed since the last submit"
+	case result.Pushed != "" && result.Pushed != commit.Hash:
+		return fmt.Sprintf("submitted %v ago, %v on the remote (only the message changed)", formatAge(now.Sub(result.Time)), shortHash(result.Pushed))
+	default:
+		return fmt.Sprintf("submitted %v ago", formatAge(now.Sub(result.Time)))
+	}
+}
+
+// submitRun is the state of the last "git pr" run, kept in .git/git-pr/run.json, for "git pr continue" to resume it
+// with the same options.
+type submitRun struct {
+	Until   string    `json:"until,omitempty"`
+	BaseRev string    `json:"base_rev,omitempty"`
+	Started time.Time `json:"started"`
+	Done    bool      `json:"done"`
+}
+
+func submitRunPath() string {
+	return filepath.Join(gitPRDir(), "run.json")
+}
+
+// loadSubmitRun reads the state of the last run, or returns nil if there is none.
+func loadSubmitRun() *submitRun {
+	data, err := os.ReadFile(submitRunPath())
+	if err != nil {
+		return nil
+	}
+	var run submitRun
+	if err = json.Unmarshal(data, &run); err != nil {
+		debugf("failed to parse the run state (ignored): %v\n", err)
+		return nil
+	}
+	return &run
+}
+
+func saveSubmitRun(run *submitRun) {
+	data := must(json.MarshalIndent(run, "", "  "))
+	if err := os.WriteFile(submitRunPath(), data, 0644); err != nil {
+		debugf("failed to save the run state (ignored): %v\n", err)
+	}
+}
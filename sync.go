@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const keepFreshMarker = "<!-- git-pr:keep-fresh -->"
+
+// syncStacks keeps the stacks up-to-date with the main branch: the current one, or all of them with -keep-fresh.
+func syncStacks(args []string) {
+	if len(args) > 0 {
+		exitCodef(ExitConfig, "usage: git pr sync [-keep-fresh]")
+	}
+	if config.SyncKeepFresh {
+		syncKeepFresh()
+	} else {
+		syncCurrentStack()
+	}
+}
+
+// syncCurrentStack rebases the current stack onto the latest main branch, dropping the commits which landed, then
+// submits it to push the branches and update the bases of the PRs. With a pinned base, submitting moves the stack.
+func syncCurrentStack() {
+	ensureGitStatusClean()
+	must(execGitRemote(config.Remote, "fetch", config.Remote, config.MainBranch))
+	originMain := fmt.Sprintf("%v/%v", config.Remote, config.MainBranch)
+	if config.BaseRev == "" {
+		mainHash := strings.TrimSpace(must(execGit("rev-parse", originMain)))
+		mergeBase := strings.TrimSpace(must(execGit("merge-base", originMain, head)))
+		if mergeBase == mainHash {
+			fmt.Printf("the stack is up-to-date with %v\n", originMain)
+		} else {
+			fmt.Printf("rebase the stack onto %v (%v)\n", originMain, mainHash[:8])
+			if _, err := execGit("rebase", originMain); err != nil {
+				exitCodef(ExitConflict, `failed to rebase the stack onto %v
+
+Hint: resolve the conflicts and run "git rebase --continue", then "git pr sync"`, originMain)
+			}
+		}
+	}
+	if len(must(getStackedCommits(originMain, head))) == 0 {
+		fmt.Printf("all the commits of the stack landed on %v\n", originMain)
+		return
+	}
+	submitStack()
+}
+
+// syncKeepFresh rebases every local stack onto the latest main branch and force-pushes the PR branches. It's meant to
+// run unattended (cron, launchd), while the user works: the stacks are rebased in a temporary worktree, the checked
+// out ones (including the detached HEAD) are only reported as stale, and the stacks which don't rebase cleanly are
+// reported and left as is.
+func syncKeepFresh() {
+	must(execGitRemote(config.Remote, "fetch", config.Remote, config.MainBranch))
+	checkGitHubHealth()
+	setupPushRemote()
+	originMain := fmt.Sprintf("%v/%v", config.Remote, config.MainBranch)
+	mainHash := strings.TrimSpace(must(execGit("rev-parse", originMain)))
+	onto := originMain
+	if baseHash := resolveBaseRev(originMain); baseHash != "" {
+		mainHash, onto = baseHash, baseHash // keep the stacks on the pinned base
+	}
+
+	var refreshed, conflicted, stale []string
+	worktrees := checkedOutWorktrees()
+	for _, branch := range listStackBranches(originMain) {
+		mergeBase := strings.TrimSpace(must(execGit("merge-base", originMain, branch)))
+		if mergeBase == mainHash {
+			fmt.Printf("%v: up-to-date\n", branch)
+			continue
+		}
+		// the user may be working on it, in the middle of a rebase or a merge: leave it to "git pr sync"
+		if worktree, checkedOut := worktrees[branch]; checkedOut || branch == head {
+			fmt.Printf("%v: behind %v, checked out in %v\n", branch, config.MainBranch, coalesce(worktree, "the current worktree"))
+			stale = append(stale, branch)
+			continue
+		}
+		newHead, err := rebaseBranch(branch, onto, mergeBase)
+		if err != nil {
+			fmt.Printf("%v: %v\n", branch, err)
+			conflicted = append(conflicted, branch)
+			continue
+		}
+
+		commits := must(getStackedCommits(originMain, newHead))
+		pushArgs := []string{"push", "-f", config.PushRemote}
+		var pushed []*Commit
+		for _, commit := range commits {
+			if commit.GetRemoteRef() != "" && isMyOwnCommit(commit) {
+				pushArgs = append(pushArgs, fmt.Sprintf("%v:refs/heads/%v", commit.Hash, commit.GetRemoteRef()))
+				pushed = append(pushed, commit)
+			}
+		}
+		fmt.Printf("%v: rebased onto %v, push %v branches\n", branch, mainHash[:8], len(pushed))
+		if len(pushed) > 0 {
+			must(execGitRemote(config.PushRemote, pushArgs...))
+		}
+		for _, commit := range pushed {
+			number := must(githubGetPRNumberByHead(commit.GetRemoteRef()))
+			if number == 0 {
+				continue
+			}
+			comment := fmt.Sprintf("🔄 Rebased onto `%v` (%v) by `git pr sync -keep-fresh` at %v.",
+				config.MainBranch, mainHash[:8], time.Now().UTC().Format(time.RFC3339))
+			must(0, githubUpsertComment(number, keepFreshMarker, comment))
+		}
+		refreshed = append(refreshed, branch)
+	}
+
+	fmt.Printf("\nrefreshed %v stack(s)\n", len(refreshed))
+	if len(stale) > 0 {
+		fmt.Printf("stale checked out stack(s): %v\n\nHint: run \"git pr sync\" in their worktree\n", strings.Join(stale, ", "))
+	}
+	if len(conflicted) > 0 {
+		exitCodef(ExitConflict, "conflicts in %v stack(s), left untouched: %v\n\nHint: rebase them manually", len(conflicted), strings.Join(conflicted, ", "))
+	}
+}
+
+// listStackBranches lists the local branches (and the detached HEAD) which have my own submitted commits on top of
+// the main branch. Branches contained in another one are skipped, to rebase each stack only once.
+func listStackBranches(originMain string) (branches []string) {
+	var candidates []string
+	out := must(execGit("for-each-ref", "--format=%(refname:short)", "refs/heads/"))
+	for _, branch := range strings.Fields(out) {
+		if branch != config.MainBranch {
+			candidates = append(candidates, branch)
+		}
+	}
+	if _, err := execGit("symbolic-ref", "-q", head); err != nil {
+		candidates = append(candidates, head) // detached HEAD, e.g. with git-branchless
+	}
+
+	var stacks []string
+	for _, branch := range candidates {
+		commits := must(getStackedCommits(originMain, branch))
+		for _, commit := range commits {
+			if commit.GetRemoteRef() != "" && isMyOwnCommit(commit) {
+				stacks = append(stacks, branch)
+				break
+			}
+		}
+	}
+	for _, branch := range stacks {
+		contained := false
+		for _, other := range stacks {
+			if other != branch && isAncestor(branch, other) && !isAncestor(other, branch) {
+				contained = true
+				break
+			}
+		}
+		if !contained && !containsString(branches, branch) {
+			branches = append(branches, branch)
+		}
+	}
+	return branches
+}
+
+// rebaseBranch rebases the commits of the branch after upstream onto the target in a temporary worktree, then moves
+// the branch, and returns the new head. The branch must not be checked out.
+func rebaseBranch(branch, onto, upstream string) (newHead string, _ error) {
+	tmpDir := must(os.MkdirTemp("", "git-pr-sync-*"))
+	must(execGit("worktree", "add", "--detach", tmpDir, branch))
+	defer func() { _, _ = execGit("worktree", "remove", "--force", tmpDir) }()
+
+	oldHead := strings.TrimSpace(must(execGit("rev-parse", branch)))
+	if _, err := execGit("-C", tmpDir, "rebase", "--onto", onto, upstream); err != nil {
+		_, _ = execGit("-C", tmpDir, "rebase", "--abort")
+		return "", errorf("conflicts when rebasing onto %v", onto)
+	}
+	newHead = strings.TrimSpace(must(execGit("-C", tmpDir, "rev-parse", head)))
+	must(execGit("update-ref", "refs/heads/"+branch, newHead, oldHead))
+	return newHead, nil
+}
+
+// replayCommits cherry-picks the commits onto the target in a temporary worktree, without touching the checkout or
+// the branches, and returns the new hash of each commit. The committer date is kept, so replaying the same commits
+// onto the same target gives the same hashes and nothing is pushed again.
+func replayCommits(commits []*Commit, onto string) (replayed map[string]string, _ error) {
+	tmpDir := must(os.MkdirTemp("", "git-pr-replay-*"))
+	must(execGit("worktree", "add", "--detach", tmpDir, onto))
+	defer func() { _, _ = execGit("worktree", "remove", "--force", tmpDir) }()
+
+	replayed = map[string]string{}
+	for _, commit := range commits {
+		date := strings.TrimSpace(must(execGit("log", "-1", "--format=%cI", commit.Hash)))
+		if _, err := execGitEnv([]string{"GIT_COMMITTER_DATE=" + date}, "-C", tmpDir, "cherry-pick", "--allow-empty", commit.Hash); err != nil {
+			_, _ = execGit("-C", tmpDir, "cherry-pick", "--abort")
+			return nil, errorf("conflicts when replaying %v onto %v", commit.ShortHash(), onto)
+		}
+		replayed[commit.Hash] = strings.TrimSpace(must(execGit("-C", tmpDir, "rev-parse", head)))
+	}
+	return replayed, nil
+}
+
+// checkedOutWorktrees maps the branches checked out in any worktree to the worktree path.
+func checkedOutWorktrees() map[string]string {
+	result := map[string]string{}
+	for _, wt := range listWorktrees() {
+		if wt.Branch != "" {
+			result[wt.Branch] = wt.Path
+		}
+	}
+	return result
+}
+
+func isAncestor(ancestor, descendant string) bool {
+	_, err := execGit("merge-base", "--is-ancestor", ancestor, descendant)
+	return err == nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
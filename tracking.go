@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const trackingIssueMarker = "<!-- git-pr:tracking-issue -->"
+
+// trackingIssue is the issue listing all the PRs of a stack, with git config git-pr.tracking-issue. The stacks are
+// recognized by the Remote-Refs of their commits, kept in .git/git-pr/tracking-issues.json with the landed PRs, which
+// are not in the stack anymore.
+type trackingIssue struct {
+	Number int      `json:"number"`
+	PRs    []int    `json:"prs"`  // from the bottom, including the landed ones
+	Refs   []string `json:"refs"` // the Remote-Refs of the commits, including the landed ones
+}
+
+func trackingIssuesPath() string {
+	return filepath.Join(gitPRDir(), "tracking-issues.json")
+}
+
+// updateTrackingIssue creates or updates the tracking issue of the stack, with the PRs as a task list checked when
+// merged. The issue is closed when none of them is open anymore.
+func updateTrackingIssue(commits []*Commit) {
+	if !config.TrackingIssue {
+		return
+	}
+	var issues []*trackingIssue
+	if data, err := os.ReadFile(trackingIssuesPath()); err == nil {
+		must(0, json.Unmarshal(data, &issues))
+	}
+	var issue *trackingIssue
+	for _, iss := range issues {
+		for _, commit := range commits {
+			if containsString(iss.Refs, commit.GetRemoteRef()) {
+				issue = iss
+			}
+		}
+	}
+	if issue == nil {
+		issue = &trackingIssue{}
+		issues = append(issues, issue)
+	}
+
+	// the landed PRs first, then the PRs of the stack in order
+	var prs []int
+	inStack := map[int]bool{}
+	for _, commit := range commits {
+		inStack[commit.PRNumber] = true
+	}
+	for _, number := range issue.PRs {
+		if !inStack[number] {
+			prs = append(prs, number)
+		}
+	}
+	for _, commit := range commits {
+		if commit.PRNumber != 0 {
+			prs = append(prs, commit.PRNumber)
+		}
+		if remoteRef := commit.GetRemoteRef(); remoteRef != "" && !containsString(issue.Refs, remoteRef) {
+			issue.Refs = append(issue.Refs, remoteRef)
+		}
+	}
+	issue.PRs = prs
+	if len(prs) == 0 {
+		return
+	}
+
+	pulls := make([]*PR, len(prs))
+	var wg sync.WaitGroup
+	for i, number := range prs {
+		i, number := i, number
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer forwardErrors()
+			pulls[i] = must(githubGetPRByNumber(number))
+		}()
+	}
+	waitGoroutines(&wg)
+	body, done := formatTrackingIssue(pulls)
+	state := xif(done, "closed", "open")
+
+	if issue.Number == 0 {
+		title := "Stack: " + commits[0].Title
+		if stackName := getStackName(commits); stackName != "" {
+			title = "Stack: " + stackName
+		}
+		issue.Number = must(githubCreateIssue(title, body))
+		fmt.Printf("created tracking issue https://%v/%v/issues/%v\n", config.Host, config.Repo, issue.Number)
+	} else {
+		must(githubUpdateIssue(issue.Number, map[string]any{"body": body, "state": state}))
+		fmt.Printf("updated tracking issue https://%v/%v/issues/%v\n", config.Host, config.Repo, issue.Number)
+	}
+	must(0, os.WriteFile(trackingIssuesPath(), must(json.MarshalIndent(issues, "", "  ")), 0644))
+}
+
+// formatTrackingIssue lists the PRs as a task list, which GitHub renders with their titles and states. It's done when
+// none of the PRs is open.
+func formatTrackingIssue(prs []*PR) (body string, done bool) {
+	var b strings.Builder
+	fprintf(&b, "%v\nThe PRs of this stack, from the bottom. Updated by `git pr`.\n\n", trackingIssueMarker)
+	done = true
+	for _, pr := range prs {
+		switch {
+		case pr.MergedAt != nil:
+			fprintf(&b, "- [x] #%v\n", pr.Number)
+		case pr.State == "closed":
+			fprintf(&b, "- [ ] ~#%v~ (closed)\n", pr.Number)
+		default:
+			done = false
+			fprintf(&b, "- [ ] #%v\n", pr.Number)
+		}
+	}
+	return b.String(), done
+}
+
+func githubCreateIssue(title, body string) (int, error) {
+	ghURL := fmt.Sprintf("https://api.%v/repos/%v/issues", config.Host, config.Repo)
+	jsonBody, err := httpPOST(ghURL, map[string]any{"title": title, "body": body})
+	if err != nil {
+		return 0, err
+	}
+	var out struct {
+		Number int `json:"number"`
+	}
+	if err = json.Unmarshal(jsonBody, &out); err != nil {
+		return 0, errorf("failed to parse request body: %v", err)
+	}
+	return out.Number, nil
+}
+
+func githubUpdateIssue(number int, fields map[string]any) ([]byte, error) {
+	ghURL := fmt.Sprintf("https://api.%v/repos/%v/issues/%v", config.Host, config.Repo, number)
+	return httpRequest("PATCH", ghURL, fields)
+}
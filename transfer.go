@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// transferStack hands the stack over to another user: the PRs are assigned to them, the Remote-Ref branches are
+// optionally moved to their namespace, and a handoff comment is posted on each PR.
+func transferStack(args []string) {
+	if len(args) != 1 {
+		exitCodef(ExitConfig, "usage: git pr transfer <user> [-rename]")
+	}
+	newOwner := strings.TrimPrefix(args[0], "@")
+	if newOwner == config.User {
+		exitCodef(ExitConfig, "the stack already belongs to %v", newOwner)
+	}
+	if config.TransferRename {
+		ensureGitStatusClean()
+	}
+
+	originMain := fmt.Sprintf("%v/%v", config.Remote, config.MainBranch)
+	stackedCommits := must(getStackedCommits(originMain, head))
+	var submitted []*Commit
+	for _, commit := range stackedCommits {
+		remoteRef := commit.GetRemoteRef()
+		if remoteRef != "" {
+			commit.PRNumber = must(githubGetPRNumberByHead(remoteRef))
+		}
+		if commit.PRNumber == 0 {
+			fmt.Printf("skip \"%v\" (no pull request)\n", shortenTitle(commit.Title))
+			continue
+		}
+		submitted = append(submitted, commit)
+	}
+	if len(submitted) == 0 {
+		exitf("no pull requests to transfer")
+	}
+
+	var renamedRefs map[string]string
+	if config.TransferRename {
+		renamedRefs = moveStackBranches(submitted, newOwner)
+	}
+
+	var prList strings.Builder
+	for _, commit := range submitted {
+		fprintf(&prList, "* #%v\n", commit.PRNumber)
+	}
+	comment := fmt.Sprintf("👋 @%v is taking over this stack from @%v:\n\n%v", newOwner, config.User, prList.String())
+	for _, commit := range submitted {
+		fmt.Printf("transfer #%v to %v\n", commit.PRNumber, newOwner)
+		must(0, githubAddAssignees(commit.PRNumber, newOwner))
+		must(0, githubRemoveAssignees(commit.PRNumber, config.User))
+		must(0, githubCreateComment(commit.PRNumber, comment))
+	}
+	// the old PRs are closed: their branches can go
+	for oldRef := range renamedRefs {
+		if err := githubDeleteBranch(oldRef); err != nil {
+			fmt.Printf("failed to delete branch %v (ignored)\n", oldRef)
+		}
+	}
+
+	// update Remote-Ref of local commits
+	findCommitToRename := func() *Commit {
+		for _, commit := range stackedCommits {
+			if _, ok := renamedRefs[commit.GetRemoteRef()]; ok {
+				return commit
+			}
+		}
+		return nil
+	}
+	for commit := findCommitToRename(); commit != nil; commit = findCommitToRename() {
+		commit.SetAttr(KeyRemoteRef, renamedRefs[commit.GetRemoteRef()])
+		must(execGit("reword", commit.Hash, "-m", commit.FullMessage()))
+
+		time.Sleep(500 * time.Millisecond)
+		stackedCommits = must(getStackedCommits(originMain, head))
+	}
+}
+
+// moveStackBranches moves the PRs of the stack to branches in the new owner's namespace, from the bottom, and returns
+// the moved branches. GitHub can't change the head branch of a PR, and closes it when its head branch is renamed or
+// deleted: the new branches are pushed at the same commits, new PRs are opened from them on top of each other, and the
+// old PRs are closed with a link to the new ones. commit.PRNumber is set to the new PR.
+func moveStackBranches(commits []*Commit, newOwner string) (moved map[string]string) {
+	moved = map[string]string{}
+	for _, commit := range commits {
+		remoteRef := commit.GetRemoteRef()
+		newRef := transferRemoteRef(remoteRef, newOwner)
+		if newRef == remoteRef {
+			continue
+		}
+		pr := must(githubGetPRByNumber(commit.PRNumber))
+		fmt.Printf("push %v to %v\n", shortHash(pr.Head.Sha), newRef)
+		must(0, githubCreateBranch(newRef, pr.Head.Sha))
+
+		head := xif(config.HeadOwner != "", config.HeadOwner+":"+newRef, newRef)
+		base := coalesce(moved[pr.Base.Ref], pr.Base.Ref) // on top of the moved PR below
+		newPR := must(githubCreatePR(NewPRBody{Title: pr.Title, Body: pr.Body, Head: head, Base: base, Draft: pr.Draft}))
+		fmt.Printf("move #%v to #%v\n", pr.Number, newPR.Number)
+		var labels, reviewers, teams []string
+		for _, label := range pr.Labels {
+			labels = append(labels, label.Name)
+		}
+		for _, reviewer := range pr.RequestedReviewers {
+			reviewers = append(reviewers, reviewer.Login)
+		}
+		for _, team := range pr.RequestedTeams {
+			teams = append(teams, team.Slug)
+		}
+		if len(labels) > 0 {
+			must(0, githubAddLabels(newPR.Number, labels...))
+		}
+		if len(reviewers)+len(teams) > 0 {
+			must(0, githubRequestReviewers(newPR.Number, reviewers, teams))
+		}
+		must(0, githubCreateComment(pr.Number, fmt.Sprintf("➡️ Moved to #%v, from the branch `%v` of @%v.", newPR.Number, newRef, newOwner)))
+		must(0, githubClosePR(pr.Number))
+		commit.PRNumber = newPR.Number
+		moved[remoteRef] = newRef
+	}
+	return moved
+}
+
+// transferRemoteRef moves the remote ref from the current user's namespace to the new owner's namespace.
+func transferRemoteRef(remoteRef, newOwner string) string {
+	prefix := config.User + "/"
+	if !strings.HasPrefix(remoteRef, prefix) {
+		return remoteRef
+	}
+	return newOwner + "/" + strings.TrimPrefix(remoteRef, prefix)
+}
@@ -95,6 +95,16 @@ func (commit *Commit) SetAttr(key, value string) {
 	})
 }
 
+func (commit *Commit) RemoveAttr(key string) {
+	attrs := commit.Attrs[:0]
+	for _, kv := range commit.Attrs {
+		if kv[0] != key {
+			attrs = append(attrs, kv)
+		}
+	}
+	commit.Attrs = attrs
+}
+
 func (commit *Commit) FullMessage() string {
 	var b strings.Builder
 	fprint(&b, commit.Title, "\n\n", commit.Message, "\n\n")
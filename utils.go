@@ -1,13 +1,16 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync"
 )
 
 func fprint(w io.Writer, args ...any) {
@@ -32,7 +35,7 @@ func wrapf(err error, msg string, args ...any) error {
 	if err == nil {
 		return nil
 	}
-	return fmt.Errorf("%v: %v", fmt.Sprintf(msg, args...), err)
+	return fmt.Errorf("%v: %w", fmt.Sprintf(msg, args...), err)
 }
 
 func debugf(msg string, args ...any) {
@@ -41,9 +44,93 @@ func debugf(msg string, args ...any) {
 	}
 }
 
+// Exit codes, for wrapper scripts to branch on the failure category. Bugs panic, which exits with 2.
+const (
+	ExitError         = 1  // generic error
+	ExitConfig        = 3  // invalid config, flags, or arguments
+	ExitUsage         = 3  // invalid flags or arguments (same as ExitConfig)
+	ExitDirtyWorktree = 4  // uncommitted changes
+	ExitAuth          = 5  // missing or invalid GitHub credentials
+	ExitConflict      = 6  // conflicts while rewriting commits
+	ExitSecrets       = 7  // likely secrets in the commits to push
+	ExitTooLarge      = 8  // commits exceed the size limits, with -strict
+	ExitChecksFailed  = 9  // checks failed or did not complete before landing
+	ExitNoTestPlan    = 10 // commits without a test plan, with git-pr.test-plan=require
+	ExitIncompatible  = 11 // git or git-branchless is missing or too old
+	ExitCommand       = 12 // a git or git-branchless command failed
+	ExitAPI           = 13 // a GitHub API request failed
+	ExitPartialLand   = 14 // the PR was merged, but a later step of the land failed
+)
+
 func exitf(msg string, args ...any) {
+	exitCodef(ExitError, msg, args...)
+}
+
+func exitCodef(code int, msg string, args ...any) {
 	fmt.Printf(msg+"\n", args...)
-	os.Exit(1)
+	exit(code)
+}
+
+// exitHooks clean up after the command, e.g. release the lock. They run when main returns, and on the early exits
+// too, where the deferred calls of main don't run.
+var (
+	exitHooks     []func()
+	exitHooksOnce sync.Once
+)
+
+// onExit registers a hook, which runs before the ones registered earlier.
+func onExit(fn func()) {
+	exitHooks = append(exitHooks, fn)
+}
+
+func runExitHooks() {
+	exitHooksOnce.Do(func() {
+		for i := len(exitHooks) - 1; i >= 0; i-- {
+			exitHooks[i]()
+		}
+	})
+}
+
+// exit runs the exit hooks, then exits with the code. Use it instead of os.Exit.
+func exit(code int) {
+	runExitHooks()
+	os.Exit(code)
+}
+
+var stdin = bufio.NewReader(os.Stdin)
+
+// workDir is the checkout to run the commands in, from -repo, or empty for the current directory. It's not in config
+// because the commands run while loading the config.
+var workDir string
+
+// promptString asks the user a question and returns the trimmed answer.
+func promptString(question string) string {
+	fmt.Print(question, " ")
+	answer, _ := stdin.ReadString('\n')
+	return strings.TrimSpace(answer)
+}
+
+// promptYesNo asks the user a yes/no question, defaulting to no. It does not block when the answer is given by
+// -assume-yes/-assume-no, or when stdin is not a terminal (the answer comes from git config git-pr.assume).
+func promptYesNo(question string) bool {
+	switch {
+	case config.AssumeYes:
+		fmt.Printf("%v [y/N] yes (-assume-yes)\n", question)
+		return true
+	case config.AssumeNo:
+		fmt.Printf("%v [y/N] no (-assume-no)\n", question)
+		return false
+	case !isTerminal(os.Stdin):
+		fmt.Printf("%v [y/N] %v (stdin is not a terminal)\n", question, xif(config.DefaultAnswer, "yes", "no"))
+		return config.DefaultAnswer
+	}
+	answer := strings.ToLower(promptString(question + " [y/N]"))
+	return answer == "y" || answer == "yes"
+}
+
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
 }
 
 func must[T any](v T, err error) T {
@@ -55,10 +142,9 @@ func must[T any](v T, err error) T {
 
 func panicf(err error, msg string, args ...any) {
 	if err != nil {
-		fmt.Println("ERROR: ", err)
+		panic(wrapf(err, msg, args...))
 	}
-
-	panic(fmt.Sprintf(msg, args...))
+	panic(errorf(msg, args...))
 }
 
 func xif[T any](cond bool, a, b T) T {
@@ -106,11 +192,54 @@ func execGit(args ...string) (string, error) {
 	return execCommand("git", args...)
 }
 
-func execGh(args ...string) (string, error) {
-	return execCommand("gh", args...)
+// execGitRemote executes a git command talking to the remote (fetch, push, ls-remote). For https remotes on GitHub, the
+// token is added as a fallback credential helper, so that it's used when no other helper has one. With a GitHub App or
+// git-pr.token-command, that token is used instead of the other helpers.
+func execGitRemote(remote string, args ...string) (string, error) {
+	url, _ := execGit("remote", "get-url", "--push", remote)
+	if !strings.HasPrefix(strings.TrimSpace(url), "https://") || (!isAppAuth() && config.Forge != forgeGitHub) {
+		return execGit(args...)
+	}
+	// the token is only given to this git command and its credential helper, not to every other command
+	helper := `!f() { echo username=x-access-token; echo "password=$GIT_PR_TOKEN"; }; f`
+	prefix := []string{"-c", "credential.https://" + config.Host + ".helper=" + helper}
+	if isAppAuth() {
+		prefix = append([]string{"-c", "credential.https://" + config.Host + ".helper="}, prefix...)
+	}
+	return execGitEnv([]string{"GIT_PR_TOKEN=" + githubToken()}, append(prefix, args...)...)
+}
+
+// execGitEnv executes a git command with extra environment variables, leaving the environment of git-pr untouched.
+func execGitEnv(env []string, args ...string) (string, error) {
+	return execCommandEnv(env, "", "git", args...)
 }
 
 func execCommand(name string, args ...string) (string, error) {
+	return execCommandWithInput("", name, args...)
+}
+
+// repoPath resolves a path relative to the checkout, e.g. from the output of git.
+func repoPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(workDir, path)
+}
+
+// execInteractive executes the command attached to the terminal, e.g. for running the editor.
+func execInteractive(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = workDir
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// execCommandWithInput executes the command with the input piped to its stdin.
+func execCommandWithInput(input string, name string, args ...string) (string, error) {
+	return execCommandEnv(nil, input, name, args...)
+}
+
+func execCommandEnv(env []string, input string, name string, args ...string) (string, error) {
 	if config.Verbose {
 		fmt.Print(name, " ")
 		for _, arg := range args {
@@ -124,10 +253,20 @@ func execCommand(name string, args ...string) (string, error) {
 	}
 	stdout := bytes.Buffer{}
 	cmd := exec.Command(name, args...)
+	cmd.Dir = workDir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 	cmd.Stdout, cmd.Stderr = &stdout, &stdout
+	if input != "" {
+		cmd.Stdin = strings.NewReader(input)
+	}
 	err := cmd.Run()
 	if err != nil {
-		fmt.Println(stdout.String())
+		if stdout.Len() > 0 {
+			fmt.Println(stdout.String())
+		}
+		return stdout.String(), &ExecError{Name: name, Args: args, Output: stdout.String(), Err: err}
 	}
-	return stdout.String(), err
+	return stdout.String(), nil
 }
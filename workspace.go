@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+type worktree struct {
+	Path   string
+	Head   string
+	Branch string // empty when detached
+}
+
+// workspaceCommand manages one worktree per stack, for working on several stacks concurrently in separate directories.
+func workspaceCommand(args []string) {
+	switch {
+	case len(args) == 2 && args[0] == "new":
+		newWorkspace(args[1])
+	case len(args) == 1 && args[0] == "list":
+		listWorkspaces()
+	default:
+		exitCodef(ExitConfig, "usage: git pr workspace new <name>\n       git pr workspace list")
+	}
+}
+
+// newWorkspace creates a worktree next to the main one ("<repo>.<name>"), detached at the latest main branch, for
+// starting a new stack.
+func newWorkspace(name string) {
+	worktrees := listWorktrees()
+	mainPath := worktrees[0].Path // the main worktree is always listed first
+	path := filepath.Join(filepath.Dir(mainPath), filepath.Base(mainPath)+"."+name)
+	if _, err := os.Stat(path); err == nil {
+		exitCodef(ExitConfig, "%v already exists", path)
+	}
+	originMain := fmt.Sprintf("%v/%v", config.Remote, config.MainBranch)
+	must(execGitRemote(config.Remote, "fetch", config.Remote, config.MainBranch))
+	must(execGit("worktree", "add", "--detach", path, originMain))
+	fmt.Printf("created workspace %v at %v\n\n    cd %v\n", name, originMain, path)
+}
+
+// listWorkspaces prints the worktrees with the stacks and PRs they hold.
+func listWorkspaces() {
+	originMain := fmt.Sprintf("%v/%v", config.Remote, config.MainBranch)
+	worktrees := listWorktrees()
+	descriptions := make([]string, len(worktrees))
+	var wg sync.WaitGroup
+	for i, wt := range worktrees {
+		i, wt := i, wt
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer forwardErrors()
+			descriptions[i] = describeWorktreeStack(wt, originMain)
+		}()
+	}
+	waitGoroutines(&wg)
+
+	width := 0
+	for _, wt := range worktrees {
+		width = xif(len(wt.Path) > width, len(wt.Path), width)
+	}
+	for i, wt := range worktrees {
+		fmt.Printf("%-*v  %-20v  %v\n", width, wt.Path, coalesce(wt.Branch, "(detached)"), descriptions[i])
+	}
+}
+
+// describeWorktreeStack describes the stack checked out in the worktree, e.g. "3 commits: #12 #13, 1 not submitted".
+func describeWorktreeStack(wt worktree, originMain string) string {
+	commits := must(getStackedCommits(originMain, wt.Head))
+	if len(commits) == 0 {
+		return "no stack"
+	}
+	var prs []string
+	notSubmitted := 0
+	for _, commit := range commits {
+		number := 0
+		if remoteRef := commit.GetRemoteRef(); remoteRef != "" {
+			number = must(githubGetPRNumberByHead(remoteRef))
+		}
+		if number == 0 {
+			notSubmitted++
+			continue
+		}
+		prs = append(prs, fmt.Sprintf("#%v", number))
+	}
+	desc := fmt.Sprintf("%v %v", len(commits), xif(len(commits) == 1, "commit", "commits"))
+	if len(prs) > 0 {
+		desc += ": " + strings.Join(prs, " ")
+	}
+	if notSubmitted > 0 {
+		desc += fmt.Sprintf(", %v not submitted", notSubmitted)
+	}
+	return desc
+}
+
+func listWorktrees() (worktrees []worktree) {
+	out := must(execGit("worktree", "list", "--porcelain"))
+	for _, line := range strings.Split(out, "\n") {
+		switch {
+		case strings.HasPrefix(line, "worktree "):
+			worktrees = append(worktrees, worktree{Path: strings.TrimPrefix(line, "worktree ")})
+		case strings.HasPrefix(line, "HEAD ") && len(worktrees) > 0:
+			worktrees[len(worktrees)-1].Head = strings.TrimPrefix(line, "HEAD ")
+		case strings.HasPrefix(line, "branch ") && len(worktrees) > 0:
+			worktrees[len(worktrees)-1].Branch = strings.TrimPrefix(line, "branch refs/heads/")
+		}
+	}
+	return worktrees
+}